@@ -16,25 +16,24 @@ fi
 
 read -s -p "Sentry database password: " sentry_db_pass
 echo
+echo "Leave the superuser fields empty to have the operator generate them."
 read -p "Sentry superuser account email: " sentry_su_email
 read -s -p "Sentry superuser account password: " sentry_su_password
 echo
 
-echo "Generating a random sentry secret key..."
-hashed_secret=$(dd if=/dev/urandom bs=1024 count=8 | md5sum | cut -c1-32)
-
-cat << EOF | kubectl --namespace=${NS} apply -f-
-apiVersion: v1
-stringData:
-  SENTRY_SECRET_KEY: ${hashed_secret}
-  SENTRY_DB_PASSWORD: ${sentry_db_pass}
-  SENTRY_SU_EMAIL: ${sentry_su_email}
-  SENTRY_SU_PASSWORD: ${sentry_su_password}
-kind: Secret
-metadata:
-  name: sentry
-  labels:
-    app: sentry
-EOF
+# the sentry secret key is generated by the operator
+{
+  echo "apiVersion: v1"
+  echo "stringData:"
+  echo "  SENTRY_DB_PASSWORD: ${sentry_db_pass}"
+  [ -n "${sentry_su_email}" ] && echo "  SENTRY_SU_EMAIL: ${sentry_su_email}"
+  [ -n "${sentry_su_password}" ] && echo "  SENTRY_SU_PASSWORD: ${sentry_su_password}"
+  echo "kind: Secret"
+  echo "metadata:"
+  echo "  name: sentry"
+  echo "  labels:"
+  echo "    app: sentry"
+} | kubectl --namespace=${NS} apply -f-
 
 echo "Done. If you run 'make install' the underlying services will use the same credentials you just created."
+echo "Generated credentials end up in the secret <sentry name>-generated."
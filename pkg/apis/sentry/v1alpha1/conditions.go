@@ -0,0 +1,77 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SentryConditionType is the type of a Sentry condition
+type SentryConditionType string
+
+const (
+	// ConditionPostgresReady tells whether the database accepts our credentials
+	ConditionPostgresReady SentryConditionType = "PostgresReady"
+	// ConditionRedisReady tells whether redis answers to our commands
+	ConditionRedisReady SentryConditionType = "RedisReady"
+	// ConditionRolledBack tells whether a failed upgrade was rolled back
+	ConditionRolledBack SentryConditionType = "RolledBack"
+	// ConditionClickHouseReady tells whether ClickHouse answers to our queries
+	ConditionClickHouseReady SentryConditionType = "ClickHouseReady"
+	// ConditionKafkaTopicsReady tells whether every kafka topic exists
+	ConditionKafkaTopicsReady SentryConditionType = "KafkaTopicsReady"
+	// ConditionSuperUserReady tells whether the superuser matches its secret
+	ConditionSuperUserReady SentryConditionType = "SuperUserReady"
+	// ConditionRolloutsProgressing tells whether every rollout is within its
+	// progress deadline
+	ConditionRolloutsProgressing SentryConditionType = "RolloutsProgressing"
+	// ConditionVersionCompatible tells whether sentryImage can be migrated to
+	// from the migrated version
+	ConditionVersionCompatible SentryConditionType = "VersionCompatible"
+)
+
+// SentryCondition describes the state of one aspect of a Sentry instance
+// +k8s:openapi-gen=true
+type SentryCondition struct {
+	//Type is the type of the condition
+	Type SentryConditionType `json:"type"`
+	//Status is one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	//Reason is a one word CamelCase reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	//Message is a human readable message with details about the last transition
+	Message string `json:"message,omitempty"`
+	//LastTransitionTime is the last time the status changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// GetCondition returns the condition of the given type, nil if not present
+func (s *SentryStatus) GetCondition(t SentryConditionType) *SentryCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == t {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// IsConditionTrue returns whether the condition of the given type is true
+func (s *SentryStatus) IsConditionTrue(t SentryConditionType) bool {
+	c := s.GetCondition(t)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
+// SetCondition adds or updates a condition, the transition time only moves
+// when the status changes
+func (s *SentryStatus) SetCondition(t SentryConditionType, status corev1.ConditionStatus, reason, message string) {
+	c := s.GetCondition(t)
+	if c == nil {
+		s.Conditions = append(s.Conditions, SentryCondition{Type: t})
+		c = &s.Conditions[len(s.Conditions)-1]
+	}
+	if c.Status != status {
+		c.Status = status
+		c.LastTransitionTime = metav1.Now()
+	}
+	c.Reason = reason
+	c.Message = message
+}
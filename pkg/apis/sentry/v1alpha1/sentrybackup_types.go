@@ -0,0 +1,180 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SentryBackupSpec defines the desired state of SentryBackup
+// +k8s:openapi-gen=true
+type SentryBackupSpec struct {
+	//Sentry is the name of the Sentry instance whose database is dumped, it
+	//has to live in the same namespace
+	Sentry string `json:"sentry"`
+	//Storage is where the dump is written
+	Storage BackupStorage `json:"storage"`
+	//Prefix is the directory or key prefix the dump is written under
+	//(defaults: the name of the Sentry instance)
+	Prefix string `json:"prefix,omitempty"`
+	//Retention is the number of dumps kept under Prefix, older ones are
+	//deleted once the backup succeeded; the dumps taken before an upgrade
+	//only count towards the retention of each other (defaults: 0, keep
+	//everything)
+	Retention int `json:"retention,omitempty"`
+	//Image is the image providing pg_dump, it must not be older than the
+	//database server (defaults: docker.io/postgres:11-alpine)
+	Image string `json:"image,omitempty"`
+	//UploaderImage is the image providing the minio client used for S3
+	//uploads (defaults: docker.io/minio/mc:RELEASE.2020-10-03T02-54-56Z)
+	UploaderImage string `json:"uploaderImage,omitempty"`
+}
+
+// BackupStorage defines where dumps are kept, exactly one of
+// PersistentVolumeClaim or S3 has to be set
+// +k8s:openapi-gen=true
+type BackupStorage struct {
+	//PersistentVolumeClaim is the name of the claim the dumps are written to
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+	//S3 is the S3 compatible bucket the dumps are uploaded to
+	S3 *S3Storage `json:"s3,omitempty"`
+}
+
+// S3Storage defines an S3 compatible bucket, such as AWS S3 or MinIO
+// +k8s:openapi-gen=true
+type S3Storage struct {
+	//Endpoint is the URL of the S3 API (defaults: https://s3.amazonaws.com)
+	Endpoint string `json:"endpoint,omitempty"`
+	//Bucket is the name of the bucket
+	Bucket string `json:"bucket"`
+	//CredentialsSecret is the name of the secret holding the access keys
+	CredentialsSecret string `json:"credentialsSecret"`
+	//AccessKeyIDKey is the key inside the credentials secret holding the
+	//access key id (defaults: AWS_ACCESS_KEY_ID)
+	AccessKeyIDKey string `json:"accessKeyIDKey,omitempty"`
+	//SecretAccessKeyKey is the key inside the credentials secret holding the
+	//secret access key (defaults: AWS_SECRET_ACCESS_KEY)
+	SecretAccessKeyKey string `json:"secretAccessKeyKey,omitempty"`
+}
+
+// SentryBackupPhase is the lifecycle phase of a backup
+type SentryBackupPhase string
+
+const (
+	// BackupPending means the backup job hasn't started yet
+	BackupPending SentryBackupPhase = "Pending"
+	// BackupRunning means the backup job is running
+	BackupRunning SentryBackupPhase = "Running"
+	// BackupCompleted means the dump was written
+	BackupCompleted SentryBackupPhase = "Completed"
+	// BackupFailed means the backup job failed
+	BackupFailed SentryBackupPhase = "Failed"
+	// BackupPruned means the dump was deleted by the retention of a later
+	// backup
+	BackupPruned SentryBackupPhase = "Pruned"
+)
+
+// SentryBackupStatus defines the observed state of SentryBackup
+// +k8s:openapi-gen=true
+type SentryBackupStatus struct {
+	//Phase is one of Pending, Running, Completed, Failed or Pruned
+	Phase SentryBackupPhase `json:"phase,omitempty"`
+	//StartTime is when the backup job started
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	//CompletionTime is when the backup job finished
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	//Duration is how long the backup took
+	Duration string `json:"duration,omitempty"`
+	//Size is the size of the dump in bytes
+	Size int64 `json:"size,omitempty"`
+	//Location is where the dump was written, as pvc://<claim>/<path> or
+	//s3://<bucket>/<key>
+	Location string `json:"location,omitempty"`
+	//Message gives details when the backup failed
+	Message string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SentryBackup is a single dump of the database of a Sentry instance
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+type SentryBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SentryBackupSpec   `json:"spec,omitempty"`
+	Status SentryBackupStatus `json:"status,omitempty"`
+}
+
+// SetDefaults set the default values for the backup spec
+func (b *SentryBackup) SetDefaults() {
+
+	sp := &b.Spec
+
+	if sp.Prefix == "" {
+		sp.Prefix = sp.Sentry
+	}
+
+	if sp.Image == "" {
+		sp.Image = "docker.io/postgres:11-alpine"
+	}
+
+	if sp.UploaderImage == "" {
+		sp.UploaderImage = "docker.io/minio/mc:RELEASE.2020-10-03T02-54-56Z"
+	}
+
+	if s3 := sp.Storage.S3; s3 != nil {
+		s3.SetDefaults()
+	}
+}
+
+// SetDefaults set the default values for the bucket
+func (s3 *S3Storage) SetDefaults() {
+	if s3.Endpoint == "" {
+		s3.Endpoint = "https://s3.amazonaws.com"
+	}
+
+	if s3.AccessKeyIDKey == "" {
+		s3.AccessKeyIDKey = "AWS_ACCESS_KEY_ID"
+	}
+
+	if s3.SecretAccessKeyKey == "" {
+		s3.SecretAccessKeyKey = "AWS_SECRET_ACCESS_KEY"
+	}
+}
+
+// AccessKeyIDSelector selects the access key id in the credentials secret
+func (s3 *S3Storage) AccessKeyIDSelector() *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: s3.CredentialsSecret},
+		Key:                  s3.AccessKeyIDKey,
+	}
+}
+
+// SecretAccessKeySelector selects the secret access key in the credentials
+// secret
+func (s3 *S3Storage) SecretAccessKeySelector() *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: s3.CredentialsSecret},
+		Key:                  s3.SecretAccessKeyKey,
+	}
+}
+
+// Finished returns whether the backup completed, failed or had its dump
+// pruned since
+func (b *SentryBackup) Finished() bool {
+	return b.Status.Phase == BackupCompleted || b.Status.Phase == BackupFailed || b.Status.Phase == BackupPruned
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SentryBackupList contains a list of SentryBackup
+type SentryBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SentryBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SentryBackup{}, &SentryBackupList{})
+}
@@ -0,0 +1,73 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SentryBackupScheduleSpec defines the desired state of SentryBackupSchedule
+// +k8s:openapi-gen=true
+type SentryBackupScheduleSpec struct {
+	//Schedule is when backups are taken, in the standard five fields cron
+	//format or one of @hourly, @daily, @weekly, @monthly and @yearly (UTC)
+	Schedule string `json:"schedule"`
+	//Suspend stops new backups from being scheduled
+	Suspend bool `json:"suspend,omitempty"`
+	//Template is the spec of the backups taken, its retention also bounds the
+	//number of successful SentryBackup objects kept (defaults: retention 7)
+	Template SentryBackupSpec `json:"template"`
+	//FailedBackupsHistoryLimit is the number of failed SentryBackup objects
+	//kept, they never count towards the retention (defaults: 3)
+	FailedBackupsHistoryLimit *int32 `json:"failedBackupsHistoryLimit,omitempty"`
+}
+
+// SentryBackupScheduleStatus defines the observed state of SentryBackupSchedule
+// +k8s:openapi-gen=true
+type SentryBackupScheduleStatus struct {
+	//LastScheduleTime is the last time a backup was due
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	//NextScheduleTime is the next time a backup is due
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+	//LastBackup is the name of the last SentryBackup created
+	LastBackup string `json:"lastBackup,omitempty"`
+	//Message gives details when the schedule can't be honoured
+	Message string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SentryBackupSchedule takes SentryBackups of a Sentry instance periodically
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+type SentryBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SentryBackupScheduleSpec   `json:"spec,omitempty"`
+	Status SentryBackupScheduleStatus `json:"status,omitempty"`
+}
+
+// SetDefaults set the default values for the schedule spec
+func (s *SentryBackupSchedule) SetDefaults() {
+
+	if s.Spec.Template.Retention == 0 {
+		s.Spec.Template.Retention = 7
+	}
+
+	if s.Spec.FailedBackupsHistoryLimit == nil {
+		limit := int32(3)
+		s.Spec.FailedBackupsHistoryLimit = &limit
+	}
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SentryBackupScheduleList contains a list of SentryBackupSchedule
+type SentryBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SentryBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SentryBackupSchedule{}, &SentryBackupScheduleList{})
+}
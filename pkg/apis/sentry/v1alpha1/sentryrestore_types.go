@@ -0,0 +1,81 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SentryRestoreSpec defines the desired state of SentryRestore
+// +k8s:openapi-gen=true
+type SentryRestoreSpec struct {
+	//Sentry is the name of the Sentry instance whose database is restored, it
+	//has to live in the same namespace
+	Sentry string `json:"sentry"`
+	//Backup is the name of the completed SentryBackup restored
+	Backup string `json:"backup"`
+	//Image is the image providing pg_restore (defaults: the image of the backup)
+	Image string `json:"image,omitempty"`
+}
+
+// SentryRestorePhase is the lifecycle phase of a restore
+type SentryRestorePhase string
+
+const (
+	// RestorePending means the restore hasn't started yet
+	RestorePending SentryRestorePhase = "Pending"
+	// RestoreScalingDown means sentry is being stopped
+	RestoreScalingDown SentryRestorePhase = "ScalingDown"
+	// RestoreRestoring means the backup is being restored
+	RestoreRestoring SentryRestorePhase = "Restoring"
+	// RestoreUpgrading means the migrations are run again and sentry restarted
+	RestoreUpgrading SentryRestorePhase = "Upgrading"
+	// RestoreCompleted means sentry is running on the restored database
+	RestoreCompleted SentryRestorePhase = "Completed"
+	// RestoreFailed means the restore gave up
+	RestoreFailed SentryRestorePhase = "Failed"
+)
+
+// SentryRestoreStatus defines the observed state of SentryRestore
+// +k8s:openapi-gen=true
+type SentryRestoreStatus struct {
+	//Phase is one of Pending, ScalingDown, Restoring, Upgrading, Completed or Failed
+	Phase SentryRestorePhase `json:"phase,omitempty"`
+	//StartTime is when sentry started being stopped
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	//RestoredTime is when the database was restored
+	RestoredTime *metav1.Time `json:"restoredTime,omitempty"`
+	//CompletionTime is when sentry was running again
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	//Message gives details on the current phase or the failure
+	Message string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SentryRestore restores the database of a Sentry instance from a SentryBackup
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+type SentryRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SentryRestoreSpec   `json:"spec,omitempty"`
+	Status SentryRestoreStatus `json:"status,omitempty"`
+}
+
+// Finished returns whether the restore completed or failed
+func (r *SentryRestore) Finished() bool {
+	return r.Status.Phase == RestoreCompleted || r.Status.Phase == RestoreFailed
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SentryRestoreList contains a list of SentryRestore
+type SentryRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SentryRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SentryRestore{}, &SentryRestoreList{})
+}
@@ -1,7 +1,9 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // SentrySpec defines the desired state of Sentry
@@ -15,8 +17,9 @@ type SentrySpec struct {
 	SentryWorkers int `json:"sentryWorkers,omitempty"`
 	//SentryEnvironment is the environment this sentry cluster belongs to (defaults: production)
 	SentryEnvironment string `json:"sentryEnvironment,omitempty"`
-	//SentrySecret is the secret holding the sentry-specific secret config values
-	SentrySecret string `json:"sentrySecret"`
+	//SentrySecret is the secret holding the sentry-specific secret config values,
+	//used for every credential that doesn't select its own secret key
+	SentrySecret string `json:"sentrySecret,omitempty"`
 	//SentrySecretKeyKey is the key inside the sentry secret holding the salt hash string
 	//for cryptography (defaults: SENTRY_SECRET_KEY)
 	SentrySecretKeyKey string `json:"sentrySecretKeyKey,omitempty"`
@@ -29,6 +32,28 @@ type SentrySpec struct {
 	//SentrySuperUserPasswordKey is the key inside the sentry secret holding the
 	//superuser's password (defaults: "SENTRY_SU_PASSWORD")
 	SentrySuperUserPasswordKey string `json:"sentrySuperUserPasswordKey,omitempty"`
+	//PostgresUserKey is the key inside the sentry secret holding the database
+	//username, only used when PostgresUser is empty (defaults: SENTRY_DB_USER)
+	PostgresUserKey string `json:"postgresUserKey,omitempty"`
+
+	//SentrySecretKeySecret selects the secret key holding the salt hash string
+	//for cryptography (defaults: SentrySecretKeyKey in SentrySecret, generated
+	//into the <name>-generated secret when missing)
+	SentrySecretKeySecret *corev1.SecretKeySelector `json:"sentrySecretKeySecret,omitempty"`
+	//PostgresUserSecret selects the secret key holding the database username,
+	//takes precedence over PostgresUser
+	PostgresUserSecret *corev1.SecretKeySelector `json:"postgresUserSecret,omitempty"`
+	//PostgresPasswordSecret selects the secret key holding the password to
+	//connect to the database (defaults: PostgresPasswordKey in SentrySecret)
+	PostgresPasswordSecret *corev1.SecretKeySelector `json:"postgresPasswordSecret,omitempty"`
+	//SentrySuperUserEmailSecret selects the secret key holding the superuser's
+	//email address (defaults: SentrySuperUserEmailKey in SentrySecret, the
+	//admin email or admin@localhost in the <name>-generated secret when missing)
+	SentrySuperUserEmailSecret *corev1.SecretKeySelector `json:"sentrySuperUserEmailSecret,omitempty"`
+	//SentrySuperUserPasswordSecret selects the secret key holding the superuser's
+	//password (defaults: SentrySuperUserPasswordKey in SentrySecret, generated
+	//into the <name>-generated secret when missing)
+	SentrySuperUserPasswordSecret *corev1.SecretKeySelector `json:"sentrySuperUserPasswordSecret,omitempty"`
 
 	//PostgresHost is the name of server running postgres
 	PostgresHost string `json:"postgresHost"`
@@ -36,15 +61,462 @@ type SentrySpec struct {
 	PostgresPort int `json:"postgresPort,omitempty"`
 	//PostgresDB is the database within postgres we're using
 	PostgresDB string `json:"postgresDB"`
-	//PostgresUser is the name of the secret containing the database username
-	PostgresUser string `json:"postgresUser"`
+	//PostgresUser is the username used to connect to the database, when neither
+	//this nor PostgresUserSecret is set it's read from the sentry secret
+	PostgresUser string `json:"postgresUser,omitempty"`
+	//PostgresSSLMode is the libpq sslmode used to connect to the database, one of
+	//disable, allow, prefer, require, verify-ca or verify-full (defaults: prefer)
+	PostgresSSLMode string `json:"postgresSSLMode,omitempty"`
+	//PostgresSSLRootCert is the CA bundle used to verify the database server's
+	//certificate, required by the verify-ca and verify-full modes
+	PostgresSSLRootCert *CertificateSource `json:"postgresSSLRootCert,omitempty"`
+	//PostgresSSLClientSecret is the name of a kubernetes.io/tls secret holding the
+	//client certificate (tls.crt) and key (tls.key) presented to the database
+	PostgresSSLClientSecret string `json:"postgresSSLClientSecret,omitempty"`
 
-	//RedisHost is the name of the server running redis
-	RedisHost string `json:"redisHost"`
+	//RedisHost is the name of the server running redis, required unless
+	//RedisSentinel is used
+	RedisHost string `json:"redisHost,omitempty"`
 	//RedisPort is the port on which the redis server is listening (defaults: 6379)
 	RedisPort int `json:"redisPort,omitempty"`
 	//RedisDB is the name of the redis instance we're using (defaults: "0")
 	RedisDB string `json:"redisDB,omitempty"`
+	//RedisPasswordSecret selects the secret key holding the password used to
+	//authenticate against redis (defaults: no authentication)
+	RedisPasswordSecret *corev1.SecretKeySelector `json:"redisPasswordSecret,omitempty"`
+	//RedisTLS enables TLS on the connections to redis
+	RedisTLS bool `json:"redisTLS,omitempty"`
+	//RedisSSLRootCert is the CA bundle used to verify the redis server's
+	//certificate when RedisTLS is enabled (defaults: the system CAs)
+	RedisSSLRootCert *CertificateSource `json:"redisSSLRootCert,omitempty"`
+	//RedisSentinel makes sentry look up the redis master through sentinel
+	//instead of connecting to RedisHost and RedisPort; the pods look it up
+	//when they start, so after a failover redis is unusable until the
+	//operator notices the new master and restarts them
+	RedisSentinel *RedisSentinelSpec `json:"redisSentinel,omitempty"`
+
+	//Memcached enables the memcached cache tier, either managed by the operator
+	//or pointing at an external endpoint (defaults: disabled)
+	Memcached *MemcachedSpec `json:"memcached,omitempty"`
+
+	//Config is rendered into the config.yml and sentry.conf.py mounted in
+	//every sentry pod, changing it rolls the pods
+	Config SentryConfigSpec `json:"config,omitempty"`
+
+	//Mail is the SMTP server sentry sends emails through (defaults: emails
+	//aren't sent)
+	Mail *MailSpec `json:"mail,omitempty"`
+
+	//Filestore is where uploaded files such as attachments, source maps and
+	//debug files are kept (defaults: the filesystem of each pod, which isn't
+	//shared between replicas)
+	Filestore *FilestoreSpec `json:"filestore,omitempty"`
+
+	//Retention runs sentry cleanup periodically to delete data older than a
+	//number of days (defaults: disabled, data is kept forever)
+	Retention *RetentionSpec `json:"retention,omitempty"`
+
+	//Snuba deploys the snuba services sentry 10 and later store and search
+	//events with, it requires Kafka (defaults: disabled, the sentry 9 topology)
+	Snuba *SnubaSpec `json:"snuba,omitempty"`
+	//Kafka is the cluster events go through on their way to snuba
+	Kafka *KafkaSpec `json:"kafka,omitempty"`
+
+	//Relay deploys relay in front of sentry to ingest events, it requires snuba
+	//(defaults: events are sent to the web pods)
+	Relay *RelaySpec `json:"relay,omitempty"`
+	//Ingress exposes sentry at a host name, the ingest endpoints go to relay
+	//when it's deployed (defaults: not exposed)
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	//Symbolicator deploys symbolicator to process native crashes with debug
+	//symbols (defaults: disabled)
+	Symbolicator *SymbolicatorSpec `json:"symbolicator,omitempty"`
+
+	//Rollouts tunes how the deployment of each component replaces its pods
+	//(defaults: the kubernetes defaults, cron is always recreated)
+	Rollouts RolloutsSpec `json:"rollouts,omitempty"`
+
+	//UpgradeBackup takes a SentryBackup before the migrations of a new
+	//sentryImage run (defaults: disabled)
+	UpgradeBackup *UpgradeBackupSpec `json:"upgradeBackup,omitempty"`
+	//Upgrade selects how the sentry processes move to a new sentryImage once
+	//its migrations ran
+	Upgrade UpgradeSpec `json:"upgrade,omitempty"`
+	//Canary runs a few web pods on a candidate image behind the web service,
+	//promoting it to sentryImage once they stayed healthy (defaults: disabled)
+	Canary *CanarySpec `json:"canary,omitempty"`
+}
+
+// SentryConfigSpec defines the sentry configuration generated by the operator
+// +k8s:openapi-gen=true
+type SentryConfigSpec struct {
+	//URLPrefix is the URL sentry is reached at, used in links and emails
+	//(system.url-prefix)
+	URLPrefix string `json:"urlPrefix,omitempty"`
+	//AdminEmail is the technical contact of the installation (system.admin-email)
+	AdminEmail string `json:"adminEmail,omitempty"`
+	//SingleOrganization hides the organization switcher (defaults: true)
+	SingleOrganization *bool `json:"singleOrganization,omitempty"`
+	//Features turns sentry features on or off by name, e.g. organizations:discover
+	Features map[string]bool `json:"features,omitempty"`
+	//Options are extra sentry options written to config.yml
+	Options map[string]string `json:"options,omitempty"`
+	//ConfigYAML is appended to the generated config.yml, the options it sets
+	//override the generated ones
+	ConfigYAML string `json:"configYAML,omitempty"`
+	//SentryConfPy is appended to the generated sentry.conf.py, the settings it
+	//sets override the generated ones
+	SentryConfPy string `json:"sentryConfPy,omitempty"`
+}
+
+// MailSpec defines the SMTP server used for outgoing mail
+// +k8s:openapi-gen=true
+type MailSpec struct {
+	//Host is the name of the SMTP server
+	Host string `json:"host"`
+	//Port is the port the SMTP server listens on (defaults: 25)
+	Port int `json:"port,omitempty"`
+	//Username is used to authenticate against the SMTP server
+	Username string `json:"username,omitempty"`
+	//PasswordSecret selects the secret key holding the password used to
+	//authenticate against the SMTP server
+	PasswordSecret *corev1.SecretKeySelector `json:"passwordSecret,omitempty"`
+	//UseTLS upgrades the connection with STARTTLS
+	UseTLS bool `json:"useTLS,omitempty"`
+	//UseSSL connects over TLS from the start, exclusive with UseTLS
+	UseSSL bool `json:"useSSL,omitempty"`
+	//From is the address emails are sent from
+	From string `json:"from"`
+	//ListNamespace is the domain used in the List-Id header of emails
+	//(defaults: localhost)
+	ListNamespace string `json:"listNamespace,omitempty"`
+}
+
+// FilestoreSpec defines the storage shared by the sentry pods for uploaded
+// files, exactly one of PersistentVolumeClaim or S3 has to be set
+// +k8s:openapi-gen=true
+type FilestoreSpec struct {
+	//PersistentVolumeClaim is the name of a ReadWriteMany claim mounted in
+	//every sentry pod
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+	//S3 is the S3 compatible bucket files are stored in
+	S3 *S3Storage `json:"s3,omitempty"`
+}
+
+// RetentionSpec defines the CronJob deleting old data
+// +k8s:openapi-gen=true
+type RetentionSpec struct {
+	//Days is the number of days of data kept (defaults: 90)
+	Days int `json:"days,omitempty"`
+	//Schedule is the cron schedule of the cleanup (defaults: "0 3 * * *")
+	Schedule string `json:"schedule,omitempty"`
+	//Concurrency is the number of workers deleting data in parallel (defaults: 1)
+	Concurrency int `json:"concurrency,omitempty"`
+	//Resources are the compute resources of the cleanup container
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	//SuccessfulJobsHistoryLimit is the number of successful cleanup jobs kept
+	//(defaults: 3)
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	//FailedJobsHistoryLimit is the number of failed cleanup jobs kept
+	//(defaults: 1)
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+}
+
+// SnubaSpec defines the snuba services
+// +k8s:openapi-gen=true
+type SnubaSpec struct {
+	//Image is the image of snuba we are running (defaults: docker.io/getsentry/snuba:latest)
+	Image string `json:"image,omitempty"`
+	//APIReplicas is the number of snuba api replicas (defaults: 1)
+	APIReplicas int `json:"apiReplicas,omitempty"`
+	//ConsumerReplicas is the number of replicas of each kafka consumer,
+	//more than the partitions of their topic sit idle (defaults: 1)
+	ConsumerReplicas int `json:"consumerReplicas,omitempty"`
+	//ClickHouse is the server snuba stores events in
+	ClickHouse ClickHouseSpec `json:"clickhouse"`
+}
+
+// ClickHouseSpec defines the ClickHouse server used by snuba, either managed
+// by the operator or pointing at an external endpoint
+// +k8s:openapi-gen=true
+type ClickHouseSpec struct {
+	//Host is the name of an external ClickHouse server, when set the operator
+	//won't deploy ClickHouse itself
+	Host string `json:"host,omitempty"`
+	//Port is the port of the native protocol (defaults: 9000)
+	Port int `json:"port,omitempty"`
+	//HTTPPort is the port of the HTTP interface (defaults: 8123)
+	HTTPPort int `json:"httpPort,omitempty"`
+	//Database is the database snuba creates its tables in (defaults: default)
+	Database string `json:"database,omitempty"`
+	//User is the user snuba connects to an external server as (defaults: default)
+	User string `json:"user,omitempty"`
+	//PasswordSecret selects the secret key holding the password of User on an
+	//external server (defaults: no password)
+	PasswordSecret *corev1.SecretKeySelector `json:"passwordSecret,omitempty"`
+	//Image is the ClickHouse image to run when managed (defaults:
+	//docker.io/yandex/clickhouse-server:20.3.9.70)
+	Image string `json:"image,omitempty"`
+	//StorageSize is the size of the volume claimed for the data when managed
+	//(defaults: 10Gi)
+	StorageSize string `json:"storageSize,omitempty"`
+	//StorageClassName is the storage class of the data volume when managed
+	//(defaults: the cluster default)
+	StorageClassName *string `json:"storageClassName,omitempty"`
+	//Resources are the compute resources of ClickHouse when managed
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// Managed returns whether the operator runs ClickHouse itself
+func (c *ClickHouseSpec) Managed() bool {
+	return c.Host == ""
+}
+
+// KafkaSpec defines the kafka cluster used by sentry and snuba
+// +k8s:openapi-gen=true
+type KafkaSpec struct {
+	//BootstrapServers are the host:port addresses of the brokers first contacted
+	BootstrapServers []string `json:"bootstrapServers"`
+	//SecurityProtocol is one of PLAINTEXT, SSL, SASL_PLAINTEXT or SASL_SSL
+	//(defaults: PLAINTEXT)
+	SecurityProtocol string `json:"securityProtocol,omitempty"`
+	//SSLRootCert is the CA bundle used to verify the brokers' certificates with
+	//the SSL and SASL_SSL protocols (defaults: the system CAs)
+	SSLRootCert *CertificateSource `json:"sslRootCert,omitempty"`
+	//SASL authenticates against the brokers with the SASL_PLAINTEXT and
+	//SASL_SSL protocols
+	SASL *KafkaSASLSpec `json:"sasl,omitempty"`
+	//Topics are created by the operator when missing
+	Topics KafkaTopicsSpec `json:"topics,omitempty"`
+}
+
+// KafkaSASLSpec defines the SASL credentials used against kafka
+// +k8s:openapi-gen=true
+type KafkaSASLSpec struct {
+	//Mechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512 (defaults: PLAIN)
+	Mechanism string `json:"mechanism,omitempty"`
+	//Username is the SASL username
+	Username string `json:"username"`
+	//PasswordSecret selects the secret key holding the SASL password
+	PasswordSecret *corev1.SecretKeySelector `json:"passwordSecret"`
+}
+
+// KafkaTopicsSpec defines how the topics sentry and snuba use are created
+// +k8s:openapi-gen=true
+type KafkaTopicsSpec struct {
+	//Partitions is the number of partitions of a new topic (defaults: 1)
+	Partitions int `json:"partitions,omitempty"`
+	//ReplicationFactor is the replication factor of a new topic (defaults: 1)
+	ReplicationFactor int `json:"replicationFactor,omitempty"`
+	//TopicPartitions overrides Partitions by topic name, topics that aren't
+	//used by sentry or snuba are created as well
+	TopicPartitions map[string]int `json:"topicPartitions,omitempty"`
+	//Image is the image providing kafka-topics.sh (defaults: docker.io/bitnami/kafka:2.7.0)
+	Image string `json:"image,omitempty"`
+}
+
+// RelaySpec defines the relay deployment
+// +k8s:openapi-gen=true
+type RelaySpec struct {
+	//Image is the image of relay we are running (defaults: docker.io/getsentry/relay:latest)
+	Image string `json:"image,omitempty"`
+	//Replicas is the number of relay replicas (defaults: 1)
+	Replicas int `json:"replicas,omitempty"`
+}
+
+// IngressSpec defines how sentry is exposed
+// +k8s:openapi-gen=true
+type IngressSpec struct {
+	//Host is the host name sentry is reached at
+	Host string `json:"host"`
+	//TLSSecretName is the name of the kubernetes.io/tls secret served for Host
+	//(defaults: plain HTTP)
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+	//Annotations are added to the ingress, e.g. to pick its class
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SymbolicatorSpec defines the symbolicator deployment
+// +k8s:openapi-gen=true
+type SymbolicatorSpec struct {
+	//Image is the image of symbolicator we are running (defaults: docker.io/getsentry/symbolicator:latest)
+	Image string `json:"image,omitempty"`
+	//Replicas is the number of symbolicator replicas, each with its own cache
+	//(defaults: 1)
+	Replicas int `json:"replicas,omitempty"`
+	//CacheSize is the size of the claim symbols are cached on (defaults: 10Gi)
+	CacheSize string `json:"cacheSize,omitempty"`
+	//StorageClassName is the storage class of the cache claim (defaults: the
+	//cluster default)
+	StorageClassName *string `json:"storageClassName,omitempty"`
+	//Resources are the resources of the symbolicator container
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	//Sources are external symbol servers added to the built-in sources of
+	//sentry, they're enabled on projects created afterwards
+	Sources []SymbolSourceSpec `json:"sources,omitempty"`
+}
+
+// SymbolSourceSpec defines an external symbol server
+// +k8s:openapi-gen=true
+type SymbolSourceSpec struct {
+	//ID identifies the source in the project settings
+	ID string `json:"id"`
+	//Name is shown in the project settings (defaults: ID)
+	Name string `json:"name,omitempty"`
+	//URL is the HTTP address of the symbol server
+	URL string `json:"url"`
+	//Layout is the directory layout of the server, one of native, symstore,
+	//symstore_index2, ssqp or unified (defaults: native)
+	Layout string `json:"layout,omitempty"`
+}
+
+// RolloutsSpec defines the rollout of each component
+// +k8s:openapi-gen=true
+type RolloutsSpec struct {
+	//Web is the rollout of the sentry web pods
+	Web *RolloutSpec `json:"web,omitempty"`
+	//Worker is the rollout of the sentry workers
+	Worker *RolloutSpec `json:"worker,omitempty"`
+	//Cron is the rollout of the sentry cron, its strategy can only be Recreate
+	Cron *RolloutSpec `json:"cron,omitempty"`
+	//Consumers is the rollout of the sentry ingest consumer and post process
+	//forwarder
+	Consumers *RolloutSpec `json:"consumers,omitempty"`
+	//Snuba is the rollout of the snuba api and consumers
+	Snuba *RolloutSpec `json:"snuba,omitempty"`
+	//Relay is the rollout of relay
+	Relay *RolloutSpec `json:"relay,omitempty"`
+	//Memcached is the rollout of the managed memcached, a statefulset which
+	//only takes the RollingUpdate strategy and revisionHistoryLimit
+	Memcached *RolloutSpec `json:"memcached,omitempty"`
+}
+
+// RolloutSpec defines how a deployment replaces its pods
+// +k8s:openapi-gen=true
+type RolloutSpec struct {
+	//Strategy is either RollingUpdate or Recreate (defaults: RollingUpdate)
+	Strategy string `json:"strategy,omitempty"`
+	//MaxSurge is the number or percentage of pods created above the replicas
+	//during a rolling update (defaults: 25%)
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+	//MaxUnavailable is the number or percentage of replicas that can be
+	//unavailable during a rolling update (defaults: 25%)
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	//MinReadySeconds is how long a new pod has to be ready before it counts
+	//as available (defaults: 0)
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+	//ProgressDeadlineSeconds is how long a rollout can go without progress
+	//before it's reported as stalled (defaults: 600)
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+	//RevisionHistoryLimit is the number of old replica sets kept to roll back
+	//to (defaults: 10)
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+}
+
+const (
+	// UpgradeInPlace rolls the sentry processes to the new image
+	UpgradeInPlace = "InPlace"
+	// UpgradeBlueGreen switches the web service to a second set of processes
+	UpgradeBlueGreen = "BlueGreen"
+)
+
+// UpgradeSpec defines how the sentry processes move to a new image
+// +k8s:openapi-gen=true
+type UpgradeSpec struct {
+	//Strategy is InPlace, rolling the processes to the new image, or
+	//BlueGreen, bringing up a second set of web, worker and cron on it and
+	//switching the web service over once it's ready; the consumers are always
+	//rolled in place (defaults: InPlace)
+	Strategy string `json:"strategy,omitempty"`
+	//PreviousSetRetentionSeconds is how long the previous set is kept scaled
+	//down after a blue/green switch, setting sentryImage back to its image in
+	//the meantime switches back to it without migrating, as long as its
+	//version runs on the migrated schema or the allow-version-skew annotation
+	//names it (defaults: 86400)
+	PreviousSetRetentionSeconds int32 `json:"previousSetRetentionSeconds,omitempty"`
+}
+
+// CanarySpec defines the canary of a candidate image on the web tier
+// +k8s:openapi-gen=true
+type CanarySpec struct {
+	//Image is the candidate sentry image, the database isn't migrated for it
+	//so it has to run against the current schema: the canary is aborted when
+	//the image is older than the migrated version, skips an upgrade hard stop
+	//or has migrations the database lacks, such images have to be upgraded to
+	//through sentryImage
+	Image string `json:"image"`
+	//Share is the number of canary web pods as a percentage of
+	//sentryWebReplicas, rounded up (defaults: 10)
+	Share int `json:"share,omitempty"`
+	//AnalysisSeconds is how long the canary pods have to stay healthy once
+	//ready before the image is promoted (defaults: 600)
+	AnalysisSeconds int32 `json:"analysisSeconds,omitempty"`
+	//MaxRestarts is the number of container restarts of the canary pods
+	//tolerated before the canary is aborted (defaults: 2)
+	MaxRestarts *int32 `json:"maxRestarts,omitempty"`
+}
+
+// UpgradeBackupSpec defines the backups taken before migrating to a new image
+// +k8s:openapi-gen=true
+type UpgradeBackupSpec struct {
+	//Storage is where the dumps are written
+	Storage BackupStorage `json:"storage"`
+	//Prefix is the directory or key prefix the dumps are written under
+	//(defaults: <name of the Sentry instance>/pre-upgrade)
+	Prefix string `json:"prefix,omitempty"`
+	//Retention is the number of pre-upgrade dumps kept under Prefix, the
+	//retention of other backups never drops them (defaults: 0, keep everything)
+	Retention int `json:"retention,omitempty"`
+	//RollbackOnFailure restores the backup and pins the deployments back to the
+	//previous image when the migrations fail
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+}
+
+// MemcachedSpec defines the memcached cache tier used by Sentry
+// +k8s:openapi-gen=true
+type MemcachedSpec struct {
+	//Host is the name of an external memcached server, when set the operator
+	//won't deploy memcached itself
+	Host string `json:"host,omitempty"`
+	//Port is the port on which memcached is listening (defaults: 11211)
+	Port int `json:"port,omitempty"`
+	//Image is the memcached image to run when managed (defaults: docker.io/memcached:1.5-alpine)
+	Image string `json:"image,omitempty"`
+	//Replicas is the number of memcached instances to run when managed (defaults: 1)
+	Replicas int `json:"replicas,omitempty"`
+	//MemoryMB is the amount of memory in megabytes each memcached instance may
+	//use for items (defaults: 64)
+	MemoryMB int `json:"memoryMB,omitempty"`
+}
+
+// Managed returns whether the operator runs memcached itself
+func (m *MemcachedSpec) Managed() bool {
+	return m.Host == ""
+}
+
+// RedisSentinelSpec defines how to find a sentinel managed redis master, it's
+// resolved once per process: the operator asks sentinel for the master every
+// 30 seconds and rolls the pods out again whenever it moves
+// +k8s:openapi-gen=true
+type RedisSentinelSpec struct {
+	//Addresses are the host:port pairs of the sentinels to query, the port
+	//defaults to 26379
+	Addresses []string `json:"addresses"`
+	//MasterName is the name of the monitored master (defaults: mymaster)
+	MasterName string `json:"masterName,omitempty"`
+}
+
+// CertificateSource points at a PEM encoded CA bundle stored either in a
+// Secret or in a ConfigMap
+// +k8s:openapi-gen=true
+type CertificateSource struct {
+	//SecretName is the name of the secret holding the CA bundle
+	SecretName string `json:"secretName,omitempty"`
+	//ConfigMapName is the name of the config map holding the CA bundle
+	ConfigMapName string `json:"configMapName,omitempty"`
+	//Key is the key holding the CA bundle (defaults: ca.crt)
+	Key string `json:"key,omitempty"`
 }
 
 // SentryStatus defines the observed state of Sentry
@@ -55,8 +527,116 @@ type SentryStatus struct {
 	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
 
 	Status string `json:"status"`
+	//Conditions are the latest observations of the instance and its dependencies
+	Conditions []SentryCondition `json:"conditions,omitempty"`
+	//MigratedImage is the last image whose migrations completed
+	MigratedImage string `json:"migratedImage,omitempty"`
+	//MigratedVersion is the sentry version of MigratedImage
+	MigratedVersion string `json:"migratedVersion,omitempty"`
+	//RedisMaster is the host:port of the redis master sentinel last reported,
+	//the pods fall back to it when they can't reach sentinel
+	RedisMaster string `json:"redisMaster,omitempty"`
+	//ImageVersions are the sentry versions found for the migrated and the
+	//target image
+	ImageVersions map[string]string `json:"imageVersions,omitempty"`
+	//FailedImage is the image whose migrations failed and were rolled back, the
+	//deployments stay on MigratedImage until sentryImage changes
+	FailedImage string `json:"failedImage,omitempty"`
+	//UpgradeBackup is the name of the SentryBackup taken before the last upgrade
+	UpgradeBackup string `json:"upgradeBackup,omitempty"`
+	//MissingKafkaTopics are the topics the last check couldn't find or create
+	MissingKafkaTopics []string `json:"missingKafkaTopics,omitempty"`
+	//SnubaMigratedImage is the last snuba image whose migrations completed
+	SnubaMigratedImage string `json:"snubaMigratedImage,omitempty"`
+	//Cleanup describes the last run of the retention cleanup
+	Cleanup *CleanupStatus `json:"cleanup,omitempty"`
+	//SecretKeyRotation describes the last rotation of the secret key
+	SecretKeyRotation *SecretKeyRotationStatus `json:"secretKeyRotation,omitempty"`
+	//StalledRollouts are the deployments whose rollout exceeded its progress
+	//deadline
+	StalledRollouts []string `json:"stalledRollouts,omitempty"`
+	//BlueGreen describes the sets of web, worker and cron deployments of the
+	//BlueGreen upgrade strategy
+	BlueGreen *BlueGreenStatus `json:"blueGreen,omitempty"`
+	//Canary describes the canary of the last candidate image
+	Canary *CanaryStatus `json:"canary,omitempty"`
+}
+
+// CanaryStatus describes the canary of a candidate image
+// +k8s:openapi-gen=true
+type CanaryStatus struct {
+	//Image is the candidate image
+	Image string `json:"image"`
+	//Phase is one of Progressing, Promoted or Aborted
+	Phase string `json:"phase,omitempty"`
+	//ReadyTime is when every canary pod was first ready
+	ReadyTime *metav1.Time `json:"readyTime,omitempty"`
+	//Restarts is the number of container restarts of the canary pods
+	Restarts int32 `json:"restarts,omitempty"`
+	//Message gives details on the current phase
+	Message string `json:"message,omitempty"`
+}
+
+// BlueGreenStatus describes the sets of the BlueGreen upgrade strategy
+// +k8s:openapi-gen=true
+type BlueGreenStatus struct {
+	//ActiveColor is the set the web service points at, blue or green
+	ActiveColor string `json:"activeColor"`
+	//ActiveImage is the image of the active set
+	ActiveImage string `json:"activeImage,omitempty"`
+	//PreviousImage is the image of the other set while it's kept for a
+	//rollback
+	PreviousImage string `json:"previousImage,omitempty"`
+	//SwitchTime is when the web service last moved to another set
+	SwitchTime *metav1.Time `json:"switchTime,omitempty"`
+	//Message gives details on the upgrade underway
+	Message string `json:"message,omitempty"`
+}
+
+// SecretKeyRotationStatus describes the last rotation of the secret key
+// +k8s:openapi-gen=true
+type SecretKeyRotationStatus struct {
+	//Requested is the value of the rotate annotation last acted upon
+	Requested string `json:"requested,omitempty"`
+	//RotationTime is when the key was last replaced
+	RotationTime *metav1.Time `json:"rotationTime,omitempty"`
+	//Phase is one of Rolling, Completed or Skipped
+	Phase string `json:"phase,omitempty"`
+	//Message gives details on the current phase
+	Message string `json:"message,omitempty"`
 }
 
+// CleanupStatus describes the last run of the retention cleanup
+// +k8s:openapi-gen=true
+type CleanupStatus struct {
+	//LastScheduleTime is when the last cleanup job was scheduled
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	//LastJob is the name of the last cleanup job
+	LastJob string `json:"lastJob,omitempty"`
+	//LastResult is one of Running, Succeeded or Failed
+	LastResult string `json:"lastResult,omitempty"`
+	//LastSuccessTime is when a cleanup last succeeded
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+}
+
+// PausedAnnotation scales the web, worker and cron processes of a Sentry down
+// and holds off its jobs for as long as it's set, its value tells who paused
+// the instance. Remove it by hand to resume an instance whose restore was
+// deleted halfway.
+const PausedAnnotation = "sentry.redhat.com/paused"
+
+// RotateSecretKeyAnnotation replaces the secret key generated by the operator
+// whenever its value changes, e.g. with the current date, and rolls the sentry
+// processes one after the other. Sessions and signed links are invalidated
+// unless sentry runs on a Django supporting SECRET_KEY_FALLBACKS.
+const RotateSecretKeyAnnotation = "sentry.redhat.com/rotate-secret-key"
+
+// AllowVersionSkewAnnotation lets the migrations of the image it names run, or
+// a blue/green rollback switch back to it, even though its version is older
+// than the migrated one, skips an upgrade hard stop or couldn't be determined.
+// It only applies to that image, so it can be left in place.
+const AllowVersionSkewAnnotation = "sentry.redhat.com/allow-version-skew"
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // Sentry is the Schema for the sentries API
@@ -70,6 +650,11 @@ type Sentry struct {
 	Status SentryStatus `json:"status,omitempty"`
 }
 
+// Paused returns whether the instance is paused
+func (s *Sentry) Paused() bool {
+	return s.Annotations[PausedAnnotation] != ""
+}
+
 // SetDefaults set the default values for the sentry spec
 func (s *Sentry) SetDefaults() {
 
@@ -95,6 +680,14 @@ func (s *Sentry) SetDefaults() {
 		sp.PostgresPort = 5432
 	}
 
+	if sp.PostgresSSLMode == "" {
+		sp.PostgresSSLMode = "prefer"
+	}
+
+	if sp.PostgresSSLRootCert != nil && sp.PostgresSSLRootCert.Key == "" {
+		sp.PostgresSSLRootCert.Key = "ca.crt"
+	}
+
 	if sp.RedisPort == 0 {
 		sp.RedisPort = 6379
 	}
@@ -103,6 +696,14 @@ func (s *Sentry) SetDefaults() {
 		sp.RedisDB = "0"
 	}
 
+	if sp.RedisSSLRootCert != nil && sp.RedisSSLRootCert.Key == "" {
+		sp.RedisSSLRootCert.Key = "ca.crt"
+	}
+
+	if sp.RedisSentinel != nil && sp.RedisSentinel.MasterName == "" {
+		sp.RedisSentinel.MasterName = "mymaster"
+	}
+
 	if sp.PostgresPasswordKey == "" {
 		sp.PostgresPasswordKey = "SENTRY_DB_PASSWORD"
 	}
@@ -118,6 +719,231 @@ func (s *Sentry) SetDefaults() {
 	if sp.SentrySuperUserPasswordKey == "" {
 		sp.SentrySuperUserPasswordKey = "SENTRY_SU_PASSWORD"
 	}
+
+	if sp.PostgresUserKey == "" {
+		sp.PostgresUserKey = "SENTRY_DB_USER"
+	}
+
+	// credentials without their own selector fall back to the sentry secret
+	if sp.SentrySecret != "" {
+		if sp.SentrySecretKeySecret == nil {
+			sp.SentrySecretKeySecret = sp.sentrySecretKeySelector(sp.SentrySecretKeyKey)
+		}
+
+		if sp.PostgresUserSecret == nil && sp.PostgresUser == "" {
+			sp.PostgresUserSecret = sp.sentrySecretKeySelector(sp.PostgresUserKey)
+		}
+
+		if sp.PostgresPasswordSecret == nil {
+			sp.PostgresPasswordSecret = sp.sentrySecretKeySelector(sp.PostgresPasswordKey)
+		}
+
+		if sp.SentrySuperUserEmailSecret == nil {
+			sp.SentrySuperUserEmailSecret = sp.sentrySecretKeySelector(sp.SentrySuperUserEmailKey)
+		}
+
+		if sp.SentrySuperUserPasswordSecret == nil {
+			sp.SentrySuperUserPasswordSecret = sp.sentrySecretKeySelector(sp.SentrySuperUserPasswordKey)
+		}
+	}
+
+	if sp.Config.SingleOrganization == nil {
+		singleOrganization := true
+		sp.Config.SingleOrganization = &singleOrganization
+	}
+
+	if m := sp.Mail; m != nil {
+		if m.Port == 0 {
+			m.Port = 25
+		}
+
+		if m.ListNamespace == "" {
+			m.ListNamespace = "localhost"
+		}
+	}
+
+	if f := sp.Filestore; f != nil && f.S3 != nil {
+		f.S3.SetDefaults()
+	}
+
+	if rt := sp.Retention; rt != nil {
+		if rt.Days == 0 {
+			rt.Days = 90
+		}
+
+		if rt.Schedule == "" {
+			rt.Schedule = "0 3 * * *"
+		}
+
+		if rt.Concurrency == 0 {
+			rt.Concurrency = 1
+		}
+
+		if rt.SuccessfulJobsHistoryLimit == nil {
+			limit := int32(3)
+			rt.SuccessfulJobsHistoryLimit = &limit
+		}
+
+		if rt.FailedJobsHistoryLimit == nil {
+			limit := int32(1)
+			rt.FailedJobsHistoryLimit = &limit
+		}
+	}
+
+	if rl := sp.Relay; rl != nil {
+		if rl.Image == "" {
+			rl.Image = "docker.io/getsentry/relay:latest"
+		}
+
+		if rl.Replicas == 0 {
+			rl.Replicas = 1
+		}
+	}
+
+	if sy := sp.Symbolicator; sy != nil {
+		if sy.Image == "" {
+			sy.Image = "docker.io/getsentry/symbolicator:latest"
+		}
+
+		if sy.Replicas == 0 {
+			sy.Replicas = 1
+		}
+
+		if sy.CacheSize == "" {
+			sy.CacheSize = "10Gi"
+		}
+
+		for i := range sy.Sources {
+			src := &sy.Sources[i]
+			if src.Name == "" {
+				src.Name = src.ID
+			}
+
+			if src.Layout == "" {
+				src.Layout = "native"
+			}
+		}
+	}
+
+	if k := sp.Kafka; k != nil {
+		if k.SecurityProtocol == "" {
+			k.SecurityProtocol = "PLAINTEXT"
+		}
+
+		if k.SSLRootCert != nil && k.SSLRootCert.Key == "" {
+			k.SSLRootCert.Key = "ca.crt"
+		}
+
+		if k.SASL != nil && k.SASL.Mechanism == "" {
+			k.SASL.Mechanism = "PLAIN"
+		}
+
+		if k.Topics.Partitions == 0 {
+			k.Topics.Partitions = 1
+		}
+
+		if k.Topics.ReplicationFactor == 0 {
+			k.Topics.ReplicationFactor = 1
+		}
+
+		if k.Topics.Image == "" {
+			k.Topics.Image = "docker.io/bitnami/kafka:2.7.0"
+		}
+	}
+
+	if sn := sp.Snuba; sn != nil {
+		if sn.Image == "" {
+			sn.Image = "docker.io/getsentry/snuba:latest"
+		}
+
+		if sn.APIReplicas == 0 {
+			sn.APIReplicas = 1
+		}
+
+		if sn.ConsumerReplicas == 0 {
+			sn.ConsumerReplicas = 1
+		}
+
+		if sn.ClickHouse.Port == 0 {
+			sn.ClickHouse.Port = 9000
+		}
+
+		if sn.ClickHouse.HTTPPort == 0 {
+			sn.ClickHouse.HTTPPort = 8123
+		}
+
+		if sn.ClickHouse.Database == "" {
+			sn.ClickHouse.Database = "default"
+		}
+
+		if sn.ClickHouse.User == "" {
+			sn.ClickHouse.User = "default"
+		}
+
+		if sn.ClickHouse.Image == "" {
+			sn.ClickHouse.Image = "docker.io/yandex/clickhouse-server:20.3.9.70"
+		}
+
+		if sn.ClickHouse.StorageSize == "" {
+			sn.ClickHouse.StorageSize = "10Gi"
+		}
+	}
+
+	if m := sp.Memcached; m != nil {
+		if m.Port == 0 {
+			m.Port = 11211
+		}
+
+		if m.Image == "" {
+			m.Image = "docker.io/memcached:1.5-alpine"
+		}
+
+		if m.Replicas == 0 {
+			m.Replicas = 1
+		}
+
+		if m.MemoryMB == 0 {
+			m.MemoryMB = 64
+		}
+	}
+
+	if c := sp.Canary; c != nil {
+		if c.Share == 0 {
+			c.Share = 10
+		}
+
+		if c.AnalysisSeconds == 0 {
+			c.AnalysisSeconds = 600
+		}
+
+		if c.MaxRestarts == nil {
+			restarts := int32(2)
+			c.MaxRestarts = &restarts
+		}
+	}
+
+	if sp.Upgrade.Strategy == "" {
+		sp.Upgrade.Strategy = UpgradeInPlace
+	}
+
+	if sp.Upgrade.PreviousSetRetentionSeconds == 0 {
+		sp.Upgrade.PreviousSetRetentionSeconds = 86400
+	}
+
+	// kept apart from the scheduled dumps, whose retention would drop them
+	if ub := sp.UpgradeBackup; ub != nil && ub.Prefix == "" {
+		ub.Prefix = s.Name + "/pre-upgrade"
+	}
+}
+
+// returns a selector for key inside the sentry secret
+func (sp *SentrySpec) sentrySecretKeySelector(key string) *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{
+			Name: sp.SentrySecret,
+		},
+		Key: key,
+	}
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -11,195 +11,2238 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
-		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.Sentry":       schema_pkg_apis_sentry_v1alpha1_Sentry(ref),
-		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentrySpec":   schema_pkg_apis_sentry_v1alpha1_SentrySpec(ref),
-		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryStatus": schema_pkg_apis_sentry_v1alpha1_SentryStatus(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.BackupStorage":              schema_pkg_apis_sentry_v1alpha1_BackupStorage(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.BlueGreenStatus":            schema_pkg_apis_sentry_v1alpha1_BlueGreenStatus(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CanarySpec":                 schema_pkg_apis_sentry_v1alpha1_CanarySpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CanaryStatus":               schema_pkg_apis_sentry_v1alpha1_CanaryStatus(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CertificateSource":          schema_pkg_apis_sentry_v1alpha1_CertificateSource(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CleanupStatus":              schema_pkg_apis_sentry_v1alpha1_CleanupStatus(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.ClickHouseSpec":             schema_pkg_apis_sentry_v1alpha1_ClickHouseSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.FilestoreSpec":              schema_pkg_apis_sentry_v1alpha1_FilestoreSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.IngressSpec":                schema_pkg_apis_sentry_v1alpha1_IngressSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.KafkaSASLSpec":              schema_pkg_apis_sentry_v1alpha1_KafkaSASLSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.KafkaSpec":                  schema_pkg_apis_sentry_v1alpha1_KafkaSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.KafkaTopicsSpec":            schema_pkg_apis_sentry_v1alpha1_KafkaTopicsSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.MailSpec":                   schema_pkg_apis_sentry_v1alpha1_MailSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.MemcachedSpec":              schema_pkg_apis_sentry_v1alpha1_MemcachedSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RedisSentinelSpec":          schema_pkg_apis_sentry_v1alpha1_RedisSentinelSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RelaySpec":                  schema_pkg_apis_sentry_v1alpha1_RelaySpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RetentionSpec":              schema_pkg_apis_sentry_v1alpha1_RetentionSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutSpec":                schema_pkg_apis_sentry_v1alpha1_RolloutSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutsSpec":               schema_pkg_apis_sentry_v1alpha1_RolloutsSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.S3Storage":                  schema_pkg_apis_sentry_v1alpha1_S3Storage(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SecretKeyRotationStatus":    schema_pkg_apis_sentry_v1alpha1_SecretKeyRotationStatus(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.Sentry":                     schema_pkg_apis_sentry_v1alpha1_Sentry(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackup":               schema_pkg_apis_sentry_v1alpha1_SentryBackup(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupSchedule":       schema_pkg_apis_sentry_v1alpha1_SentryBackupSchedule(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupScheduleSpec":   schema_pkg_apis_sentry_v1alpha1_SentryBackupScheduleSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupScheduleStatus": schema_pkg_apis_sentry_v1alpha1_SentryBackupScheduleStatus(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupSpec":           schema_pkg_apis_sentry_v1alpha1_SentryBackupSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupStatus":         schema_pkg_apis_sentry_v1alpha1_SentryBackupStatus(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryCondition":            schema_pkg_apis_sentry_v1alpha1_SentryCondition(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryConfigSpec":           schema_pkg_apis_sentry_v1alpha1_SentryConfigSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryRestore":              schema_pkg_apis_sentry_v1alpha1_SentryRestore(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryRestoreSpec":          schema_pkg_apis_sentry_v1alpha1_SentryRestoreSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryRestoreStatus":        schema_pkg_apis_sentry_v1alpha1_SentryRestoreStatus(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentrySpec":                 schema_pkg_apis_sentry_v1alpha1_SentrySpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryStatus":               schema_pkg_apis_sentry_v1alpha1_SentryStatus(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SnubaSpec":                  schema_pkg_apis_sentry_v1alpha1_SnubaSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SymbolSourceSpec":           schema_pkg_apis_sentry_v1alpha1_SymbolSourceSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SymbolicatorSpec":           schema_pkg_apis_sentry_v1alpha1_SymbolicatorSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.UpgradeBackupSpec":          schema_pkg_apis_sentry_v1alpha1_UpgradeBackupSpec(ref),
+		"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.UpgradeSpec":                schema_pkg_apis_sentry_v1alpha1_UpgradeSpec(ref),
 	}
 }
 
-func schema_pkg_apis_sentry_v1alpha1_Sentry(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_sentry_v1alpha1_BackupStorage(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "Sentry is the Schema for the sentries API",
+				Description: "BackupStorage defines where dumps are kept, exactly one of PersistentVolumeClaim or S3 has to be set",
 				Properties: map[string]spec.Schema{
-					"kind": {
+					"persistentVolumeClaim": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Description: "PersistentVolumeClaim is the name of the claim the dumps are written to",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"apiVersion": {
+					"s3": {
 						SchemaProps: spec.SchemaProps{
-							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Description: "S3 is the S3 compatible bucket the dumps are uploaded to",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.S3Storage"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.S3Storage"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_BlueGreenStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "BlueGreenStatus describes the sets of the BlueGreen upgrade strategy",
+				Properties: map[string]spec.Schema{
+					"activeColor": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ActiveColor is the set the web service points at, blue or green",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"metadata": {
+					"activeImage": {
 						SchemaProps: spec.SchemaProps{
-							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+							Description: "ActiveImage is the image of the active set",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
-					"spec": {
+					"previousImage": {
 						SchemaProps: spec.SchemaProps{
-							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentrySpec"),
+							Description: "PreviousImage is the image of the other set while it's kept for a rollback",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
-					"status": {
+					"switchTime": {
 						SchemaProps: spec.SchemaProps{
-							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryStatus"),
+							Description: "SwitchTime is when the web service last moved to another set",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message gives details on the upgrade underway",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
 				},
+				Required: []string{"activeColor"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentrySpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
 
-func schema_pkg_apis_sentry_v1alpha1_SentrySpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_sentry_v1alpha1_CanarySpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "SentrySpec defines the desired state of Sentry",
+				Description: "CanarySpec defines the canary of a candidate image on the web tier",
 				Properties: map[string]spec.Schema{
-					"sentryImage": {
+					"image": {
 						SchemaProps: spec.SchemaProps{
-							Description: "SentryImage is the image of sentry we are running (defaults: docker.io/sentry:latest)",
+							Description: "Image is the candidate sentry image, the database isn't migrated for it so it has to run against the current schema: the canary is aborted when the image is older than the migrated version, skips an upgrade hard stop or has migrations the database lacks, such images have to be upgraded to through sentryImage",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"sentryWebReplicas": {
+					"share": {
 						SchemaProps: spec.SchemaProps{
-							Description: "SentryWebReplicas is the number of web workers to spawn (defaults: 2)",
+							Description: "Share is the number of canary web pods as a percentage of sentryWebReplicas, rounded up (defaults: 10)",
 							Type:        []string{"integer"},
 							Format:      "int32",
 						},
 					},
-					"sentryWorkers": {
+					"analysisSeconds": {
 						SchemaProps: spec.SchemaProps{
-							Description: "SentryWorkers is the number of async workers to spawn (defaults: 3)",
+							Description: "AnalysisSeconds is how long the canary pods have to stay healthy once ready before the image is promoted (defaults: 600)",
 							Type:        []string{"integer"},
 							Format:      "int32",
 						},
 					},
-					"sentryEnvironment": {
+					"maxRestarts": {
 						SchemaProps: spec.SchemaProps{
-							Description: "SentryEnvironment is the environment this sentry cluster belongs to (defaults: production)",
+							Description: "MaxRestarts is the number of container restarts of the canary pods tolerated before the canary is aborted (defaults: 2)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+				Required: []string{"image"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_CanaryStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CanaryStatus describes the canary of a candidate image",
+				Properties: map[string]spec.Schema{
+					"image": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Image is the candidate image",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"sentrySecret": {
+					"phase": {
 						SchemaProps: spec.SchemaProps{
-							Description: "SentrySecret is the secret holding the sentry-specific secret config values",
+							Description: "Phase is one of Progressing, Promoted or Aborted",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"sentrySecretKeyKey": {
+					"readyTime": {
 						SchemaProps: spec.SchemaProps{
-							Description: "SentrySecretKeyKey is the key inside the sentry secret holding the salt hash string for cryptography (defaults: SENTRY_SECRET_KEY)",
+							Description: "ReadyTime is when every canary pod was first ready",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"restarts": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Restarts is the number of container restarts of the canary pods",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message gives details on the current phase",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"postgresPasswordKey": {
+				},
+				Required: []string{"image"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_CertificateSource(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CertificateSource points at a PEM encoded CA bundle stored either in a Secret or in a ConfigMap",
+				Properties: map[string]spec.Schema{
+					"secretName": {
 						SchemaProps: spec.SchemaProps{
-							Description: "PostgresPasswordKey is the key inside the sentry secret holding the password to connect to the database (defaults: SENTRY_DB_PASSWORD)",
+							Description: "SecretName is the name of the secret holding the CA bundle",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"sentrySuperUserEmailKey": {
+					"configMapName": {
 						SchemaProps: spec.SchemaProps{
-							Description: "SentrySuperUserEmailKey is the key inside the sentry secret holding the superuser's email address (defaults: \"SENTRY_SU_EMAIL\")",
+							Description: "ConfigMapName is the name of the config map holding the CA bundle",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"sentrySuperUserPasswordKey": {
+					"key": {
 						SchemaProps: spec.SchemaProps{
-							Description: "SentrySuperUserPasswordKey is the key inside the sentry secret holding the superuser's password (defaults: \"SENTRY_SU_PASSWORD\")",
+							Description: "Key is the key holding the CA bundle (defaults: ca.crt)",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"postgresHost": {
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_CleanupStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CleanupStatus describes the last run of the retention cleanup",
+				Properties: map[string]spec.Schema{
+					"lastScheduleTime": {
 						SchemaProps: spec.SchemaProps{
-							Description: "PostgresHost is the name of server running postgres",
+							Description: "LastScheduleTime is when the last cleanup job was scheduled",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"lastJob": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastJob is the name of the last cleanup job",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"postgresPort": {
+					"lastResult": {
 						SchemaProps: spec.SchemaProps{
-							Description: "PostgresPort is the port on which the database server is listening (defaults: 5432)",
+							Description: "LastResult is one of Running, Succeeded or Failed",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastSuccessTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastSuccessTime is when a cleanup last succeeded",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_ClickHouseSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClickHouseSpec defines the ClickHouse server used by snuba, either managed by the operator or pointing at an external endpoint",
+				Properties: map[string]spec.Schema{
+					"host": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Host is the name of an external ClickHouse server, when set the operator won't deploy ClickHouse itself",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"port": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Port is the port of the native protocol (defaults: 9000)",
 							Type:        []string{"integer"},
 							Format:      "int32",
 						},
 					},
-					"postgresDB": {
+					"httpPort": {
 						SchemaProps: spec.SchemaProps{
-							Description: "PostgresDB is the database within postgres we're using",
+							Description: "HTTPPort is the port of the HTTP interface (defaults: 8123)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"database": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Database is the database snuba creates its tables in (defaults: default)",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"postgresUser": {
+					"user": {
 						SchemaProps: spec.SchemaProps{
-							Description: "PostgresUser is the name of the secret containing the database username",
+							Description: "User is the user snuba connects to an external server as (defaults: default)",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"redisHost": {
+					"passwordSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PasswordSecret selects the secret key holding the password of User on an external server (defaults: no password)",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+					"image": {
 						SchemaProps: spec.SchemaProps{
-							Description: "RedisHost is the name of the server running redis",
+							Description: "Image is the ClickHouse image to run when managed (defaults: docker.io/yandex/clickhouse-server:20.3.9.70)",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
-					"redisPort": {
+					"storageSize": {
 						SchemaProps: spec.SchemaProps{
-							Description: "RedisPort is the port on which the redis server is listening (defaults: 6379)",
-							Type:        []string{"integer"},
-							Format:      "int32",
+							Description: "StorageSize is the size of the volume claimed for the data when managed (defaults: 10Gi)",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
-					"redisDB": {
+					"storageClassName": {
 						SchemaProps: spec.SchemaProps{
-							Description: "RedisDB is the name of the redis instance we're using (defaults: \"0\")",
+							Description: "StorageClassName is the storage class of the data volume when managed (defaults: the cluster default)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"resources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Resources are the compute resources of ClickHouse when managed",
+							Ref:         ref("k8s.io/api/core/v1.ResourceRequirements"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/api/core/v1.ResourceRequirements", "k8s.io/api/core/v1.SecretKeySelector"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_FilestoreSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "FilestoreSpec defines the storage shared by the sentry pods for uploaded files, exactly one of PersistentVolumeClaim or S3 has to be set",
+				Properties: map[string]spec.Schema{
+					"persistentVolumeClaim": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PersistentVolumeClaim is the name of a ReadWriteMany claim mounted in every sentry pod",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"s3": {
+						SchemaProps: spec.SchemaProps{
+							Description: "S3 is the S3 compatible bucket files are stored in",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.S3Storage"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.S3Storage"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_IngressSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "IngressSpec defines how sentry is exposed",
+				Properties: map[string]spec.Schema{
+					"host": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Host is the host name sentry is reached at",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"tlsSecretName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TLSSecretName is the name of the kubernetes.io/tls secret served for Host (defaults: plain HTTP)",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
+					"annotations": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Annotations are added to the ingress, e.g. to pick its class",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
 				},
-				Required: []string{"sentrySecret", "postgresHost", "postgresDB", "postgresUser", "redisHost"},
+				Required: []string{"host"},
 			},
 		},
 		Dependencies: []string{},
 	}
 }
 
-func schema_pkg_apis_sentry_v1alpha1_SentryStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_sentry_v1alpha1_KafkaSASLSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "SentryStatus defines the observed state of Sentry",
+				Description: "KafkaSASLSpec defines the SASL credentials used against kafka",
 				Properties: map[string]spec.Schema{
-					"status": {
+					"mechanism": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "Mechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512 (defaults: PLAIN)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"username": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Username is the SASL username",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"passwordSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PasswordSecret selects the secret key holding the SASL password",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+				},
+				Required: []string{"username", "passwordSecret"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/api/core/v1.SecretKeySelector"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_KafkaSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "KafkaSpec defines the kafka cluster used by sentry and snuba",
+				Properties: map[string]spec.Schema{
+					"bootstrapServers": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BootstrapServers are the host:port addresses of the brokers first contacted",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"securityProtocol": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SecurityProtocol is one of PLAINTEXT, SSL, SASL_PLAINTEXT or SASL_SSL (defaults: PLAINTEXT)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sslRootCert": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SSLRootCert is the CA bundle used to verify the brokers' certificates with the SSL and SASL_SSL protocols (defaults: the system CAs)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CertificateSource"),
+						},
+					},
+					"sasl": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SASL authenticates against the brokers with the SASL_PLAINTEXT and SASL_SSL protocols",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.KafkaSASLSpec"),
+						},
+					},
+					"topics": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Topics are created by the operator when missing",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.KafkaTopicsSpec"),
+						},
+					},
+				},
+				Required: []string{"bootstrapServers"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CertificateSource", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.KafkaSASLSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.KafkaTopicsSpec"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_KafkaTopicsSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "KafkaTopicsSpec defines how the topics sentry and snuba use are created",
+				Properties: map[string]spec.Schema{
+					"partitions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Partitions is the number of partitions of a new topic (defaults: 1)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"replicationFactor": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ReplicationFactor is the replication factor of a new topic (defaults: 1)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"topicPartitions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TopicPartitions overrides Partitions by topic name, topics that aren't used by sentry or snuba are created as well",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"integer"},
+										Format: "int32",
+									},
+								},
+							},
+						},
+					},
+					"image": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Image is the image providing kafka-topics.sh (defaults: docker.io/bitnami/kafka:2.7.0)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_MailSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "MailSpec defines the SMTP server used for outgoing mail",
+				Properties: map[string]spec.Schema{
+					"host": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Host is the name of the SMTP server",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"port": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Port is the port the SMTP server listens on (defaults: 25)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"username": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Username is used to authenticate against the SMTP server",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"passwordSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PasswordSecret selects the secret key holding the password used to authenticate against the SMTP server",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+					"useTLS": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UseTLS upgrades the connection with STARTTLS",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"useSSL": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UseSSL connects over TLS from the start, exclusive with UseTLS",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"from": {
+						SchemaProps: spec.SchemaProps{
+							Description: "From is the address emails are sent from",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"listNamespace": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ListNamespace is the domain used in the List-Id header of emails (defaults: localhost)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"host", "from"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/api/core/v1.SecretKeySelector"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_MemcachedSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "MemcachedSpec defines the memcached cache tier used by Sentry",
+				Properties: map[string]spec.Schema{
+					"host": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Host is the name of an external memcached server, when set the operator won't deploy memcached itself",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"port": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Port is the port on which memcached is listening (defaults: 11211)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"image": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Image is the memcached image to run when managed (defaults: docker.io/memcached:1.5-alpine)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"replicas": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Replicas is the number of memcached instances to run when managed (defaults: 1)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"memoryMB": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MemoryMB is the amount of memory in megabytes each memcached instance may use for items (defaults: 64)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_RedisSentinelSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RedisSentinelSpec defines how to find a sentinel managed redis master, it's resolved once per process: the operator asks sentinel for the master every 30 seconds and rolls the pods out again whenever it moves",
+				Properties: map[string]spec.Schema{
+					"addresses": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Addresses are the host:port pairs of the sentinels to query, the port defaults to 26379",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"masterName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MasterName is the name of the monitored master (defaults: mymaster)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"addresses"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_RelaySpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RelaySpec defines the relay deployment",
+				Properties: map[string]spec.Schema{
+					"image": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Image is the image of relay we are running (defaults: docker.io/getsentry/relay:latest)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"replicas": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Replicas is the number of relay replicas (defaults: 1)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_RetentionSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RetentionSpec defines the CronJob deleting old data",
+				Properties: map[string]spec.Schema{
+					"days": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Days is the number of days of data kept (defaults: 90)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"schedule": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Schedule is the cron schedule of the cleanup (defaults: \"0 3 * * *\")",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"concurrency": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Concurrency is the number of workers deleting data in parallel (defaults: 1)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"resources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Resources are the compute resources of the cleanup container",
+							Ref:         ref("k8s.io/api/core/v1.ResourceRequirements"),
+						},
+					},
+					"successfulJobsHistoryLimit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SuccessfulJobsHistoryLimit is the number of successful cleanup jobs kept (defaults: 3)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"failedJobsHistoryLimit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "FailedJobsHistoryLimit is the number of failed cleanup jobs kept (defaults: 1)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/api/core/v1.ResourceRequirements"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_RolloutSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RolloutSpec defines how a deployment replaces its pods",
+				Properties: map[string]spec.Schema{
+					"strategy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Strategy is either RollingUpdate or Recreate (defaults: RollingUpdate)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"maxSurge": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MaxSurge is the number or percentage of pods created above the replicas during a rolling update (defaults: 25%)",
+							Ref:         ref("k8s.io/apimachinery/pkg/util/intstr.IntOrString"),
+						},
+					},
+					"maxUnavailable": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MaxUnavailable is the number or percentage of replicas that can be unavailable during a rolling update (defaults: 25%)",
+							Ref:         ref("k8s.io/apimachinery/pkg/util/intstr.IntOrString"),
+						},
+					},
+					"minReadySeconds": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MinReadySeconds is how long a new pod has to be ready before it counts as available (defaults: 0)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"progressDeadlineSeconds": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ProgressDeadlineSeconds is how long a rollout can go without progress before it's reported as stalled (defaults: 600)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"revisionHistoryLimit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RevisionHistoryLimit is the number of old replica sets kept to roll back to (defaults: 10)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/util/intstr.IntOrString"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_RolloutsSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RolloutsSpec defines the rollout of each component",
+				Properties: map[string]spec.Schema{
+					"web": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Web is the rollout of the sentry web pods",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutSpec"),
+						},
+					},
+					"worker": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Worker is the rollout of the sentry workers",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutSpec"),
+						},
+					},
+					"cron": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Cron is the rollout of the sentry cron, its strategy can only be Recreate",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutSpec"),
+						},
+					},
+					"consumers": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Consumers is the rollout of the sentry ingest consumer and post process forwarder",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutSpec"),
+						},
+					},
+					"snuba": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Snuba is the rollout of the snuba api and consumers",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutSpec"),
+						},
+					},
+					"relay": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Relay is the rollout of relay",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutSpec"),
+						},
+					},
+					"memcached": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Memcached is the rollout of the managed memcached, a statefulset which only takes the RollingUpdate strategy and revisionHistoryLimit",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutSpec"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutSpec"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_S3Storage(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "S3Storage defines an S3 compatible bucket, such as AWS S3 or MinIO",
+				Properties: map[string]spec.Schema{
+					"endpoint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Endpoint is the URL of the S3 API (defaults: https://s3.amazonaws.com)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"bucket": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Bucket is the name of the bucket",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"credentialsSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CredentialsSecret is the name of the secret holding the access keys",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"accessKeyIDKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AccessKeyIDKey is the key inside the credentials secret holding the access key id (defaults: AWS_ACCESS_KEY_ID)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"secretAccessKeyKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SecretAccessKeyKey is the key inside the credentials secret holding the secret access key (defaults: AWS_SECRET_ACCESS_KEY)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"bucket", "credentialsSecret"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SecretKeyRotationStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SecretKeyRotationStatus describes the last rotation of the secret key",
+				Properties: map[string]spec.Schema{
+					"requested": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Requested is the value of the rotate annotation last acted upon",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"rotationTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RotationTime is when the key was last replaced",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"phase": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Phase is one of Rolling, Completed or Skipped",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message gives details on the current phase",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_Sentry(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Sentry is the Schema for the sentries API",
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentrySpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentrySpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryBackup(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryBackup is a single dump of the database of a Sentry instance",
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryBackupSchedule(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryBackupSchedule takes SentryBackups of a Sentry instance periodically",
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupScheduleSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupScheduleStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupScheduleSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupScheduleStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryBackupScheduleSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryBackupScheduleSpec defines the desired state of SentryBackupSchedule",
+				Properties: map[string]spec.Schema{
+					"schedule": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Schedule is when backups are taken, in the standard five fields cron format or one of @hourly, @daily, @weekly, @monthly and @yearly (UTC)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"suspend": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Suspend stops new backups from being scheduled",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"template": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Template is the spec of the backups taken, its retention also bounds the number of successful SentryBackup objects kept (defaults: retention 7)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupSpec"),
+						},
+					},
+					"failedBackupsHistoryLimit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "FailedBackupsHistoryLimit is the number of failed SentryBackup objects kept, they never count towards the retention (defaults: 3)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+				Required: []string{"schedule", "template"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryBackupSpec"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryBackupScheduleStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryBackupScheduleStatus defines the observed state of SentryBackupSchedule",
+				Properties: map[string]spec.Schema{
+					"lastScheduleTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastScheduleTime is the last time a backup was due",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"nextScheduleTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "NextScheduleTime is the next time a backup is due",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"lastBackup": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastBackup is the name of the last SentryBackup created",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message gives details when the schedule can't be honoured",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryBackupSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryBackupSpec defines the desired state of SentryBackup",
+				Properties: map[string]spec.Schema{
+					"sentry": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Sentry is the name of the Sentry instance whose database is dumped, it has to live in the same namespace",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"storage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Storage is where the dump is written",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.BackupStorage"),
+						},
+					},
+					"prefix": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Prefix is the directory or key prefix the dump is written under (defaults: the name of the Sentry instance)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"retention": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Retention is the number of dumps kept under Prefix, older ones are deleted once the backup succeeded; the dumps taken before an upgrade only count towards the retention of each other (defaults: 0, keep everything)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"image": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Image is the image providing pg_dump, it must not be older than the database server (defaults: docker.io/postgres:11-alpine)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"uploaderImage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UploaderImage is the image providing the minio client used for S3 uploads (defaults: docker.io/minio/mc:RELEASE.2020-10-03T02-54-56Z)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"sentry", "storage"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.BackupStorage"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryBackupStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryBackupStatus defines the observed state of SentryBackup",
+				Properties: map[string]spec.Schema{
+					"phase": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Phase is one of Pending, Running, Completed, Failed or Pruned",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"startTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "StartTime is when the backup job started",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"completionTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CompletionTime is when the backup job finished",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"duration": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Duration is how long the backup took",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"size": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Size is the size of the dump in bytes",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"location": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Location is where the dump was written, as pvc://<claim>/<path> or s3://<bucket>/<key>",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message gives details when the backup failed",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryCondition(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryCondition describes the state of one aspect of a Sentry instance",
+				Properties: map[string]spec.Schema{
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Type is the type of the condition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Status is one of True, False or Unknown",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"reason": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Reason is a one word CamelCase reason for the last transition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message is a human readable message with details about the last transition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastTransitionTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastTransitionTime is the last time the status changed",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+				},
+				Required: []string{"type", "status"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryConfigSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryConfigSpec defines the sentry configuration generated by the operator",
+				Properties: map[string]spec.Schema{
+					"urlPrefix": {
+						SchemaProps: spec.SchemaProps{
+							Description: "URLPrefix is the URL sentry is reached at, used in links and emails (system.url-prefix)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"adminEmail": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AdminEmail is the technical contact of the installation (system.admin-email)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"singleOrganization": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SingleOrganization hides the organization switcher (defaults: true)",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"features": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Features turns sentry features on or off by name, e.g. organizations:discover",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"boolean"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"options": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Options are extra sentry options written to config.yml",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"configYAML": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ConfigYAML is appended to the generated config.yml, the options it sets override the generated ones",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sentryConfPy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentryConfPy is appended to the generated sentry.conf.py, the settings it sets override the generated ones",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryRestore(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryRestore restores the database of a Sentry instance from a SentryBackup",
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryRestoreSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryRestoreStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryRestoreSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryRestoreStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryRestoreSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryRestoreSpec defines the desired state of SentryRestore",
+				Properties: map[string]spec.Schema{
+					"sentry": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Sentry is the name of the Sentry instance whose database is restored, it has to live in the same namespace",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"backup": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Backup is the name of the completed SentryBackup restored",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"image": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Image is the image providing pg_restore (defaults: the image of the backup)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"sentry", "backup"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryRestoreStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryRestoreStatus defines the observed state of SentryRestore",
+				Properties: map[string]spec.Schema{
+					"phase": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Phase is one of Pending, ScalingDown, Restoring, Upgrading, Completed or Failed",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"startTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "StartTime is when sentry started being stopped",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"restoredTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RestoredTime is when the database was restored",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"completionTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CompletionTime is when sentry was running again",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message gives details on the current phase or the failure",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentrySpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentrySpec defines the desired state of Sentry",
+				Properties: map[string]spec.Schema{
+					"sentryImage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentryImage is the image of sentry we are running (defaults: docker.io/sentry:latest)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sentryWebReplicas": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentryWebReplicas is the number of web workers to spawn (defaults: 2)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"sentryWorkers": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentryWorkers is the number of async workers to spawn (defaults: 3)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"sentryEnvironment": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentryEnvironment is the environment this sentry cluster belongs to (defaults: production)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sentrySecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentrySecret is the secret holding the sentry-specific secret config values, used for every credential that doesn't select its own secret key",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sentrySecretKeyKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentrySecretKeyKey is the key inside the sentry secret holding the salt hash string for cryptography (defaults: SENTRY_SECRET_KEY)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"postgresPasswordKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresPasswordKey is the key inside the sentry secret holding the password to connect to the database (defaults: SENTRY_DB_PASSWORD)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sentrySuperUserEmailKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentrySuperUserEmailKey is the key inside the sentry secret holding the superuser's email address (defaults: \"SENTRY_SU_EMAIL\")",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sentrySuperUserPasswordKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentrySuperUserPasswordKey is the key inside the sentry secret holding the superuser's password (defaults: \"SENTRY_SU_PASSWORD\")",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"postgresUserKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresUserKey is the key inside the sentry secret holding the database username, only used when PostgresUser is empty (defaults: SENTRY_DB_USER)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sentrySecretKeySecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentrySecretKeySecret selects the secret key holding the salt hash string for cryptography (defaults: SentrySecretKeyKey in SentrySecret, generated into the <name>-generated secret when missing)",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+					"postgresUserSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresUserSecret selects the secret key holding the database username, takes precedence over PostgresUser",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+					"postgresPasswordSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresPasswordSecret selects the secret key holding the password to connect to the database (defaults: PostgresPasswordKey in SentrySecret)",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+					"sentrySuperUserEmailSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentrySuperUserEmailSecret selects the secret key holding the superuser's email address (defaults: SentrySuperUserEmailKey in SentrySecret, the admin email or admin@localhost in the <name>-generated secret when missing)",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+					"sentrySuperUserPasswordSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SentrySuperUserPasswordSecret selects the secret key holding the superuser's password (defaults: SentrySuperUserPasswordKey in SentrySecret, generated into the <name>-generated secret when missing)",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+					"postgresHost": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresHost is the name of server running postgres",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"postgresPort": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresPort is the port on which the database server is listening (defaults: 5432)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"postgresDB": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresDB is the database within postgres we're using",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"postgresUser": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresUser is the username used to connect to the database, when neither this nor PostgresUserSecret is set it's read from the sentry secret",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"postgresSSLMode": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresSSLMode is the libpq sslmode used to connect to the database, one of disable, allow, prefer, require, verify-ca or verify-full (defaults: prefer)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"postgresSSLRootCert": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresSSLRootCert is the CA bundle used to verify the database server's certificate, required by the verify-ca and verify-full modes",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CertificateSource"),
+						},
+					},
+					"postgresSSLClientSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostgresSSLClientSecret is the name of a kubernetes.io/tls secret holding the client certificate (tls.crt) and key (tls.key) presented to the database",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"redisHost": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RedisHost is the name of the server running redis, required unless RedisSentinel is used",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"redisPort": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RedisPort is the port on which the redis server is listening (defaults: 6379)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"redisDB": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RedisDB is the name of the redis instance we're using (defaults: \"0\")",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"redisPasswordSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RedisPasswordSecret selects the secret key holding the password used to authenticate against redis (defaults: no authentication)",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+					"redisTLS": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RedisTLS enables TLS on the connections to redis",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"redisSSLRootCert": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RedisSSLRootCert is the CA bundle used to verify the redis server's certificate when RedisTLS is enabled (defaults: the system CAs)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CertificateSource"),
+						},
+					},
+					"redisSentinel": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RedisSentinel makes sentry look up the redis master through sentinel instead of connecting to RedisHost and RedisPort; the pods look it up when they start, so after a failover redis is unusable until the operator notices the new master and restarts them",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RedisSentinelSpec"),
+						},
+					},
+					"memcached": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Memcached enables the memcached cache tier, either managed by the operator or pointing at an external endpoint (defaults: disabled)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.MemcachedSpec"),
+						},
+					},
+					"config": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Config is rendered into the config.yml and sentry.conf.py mounted in every sentry pod, changing it rolls the pods",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryConfigSpec"),
+						},
+					},
+					"mail": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Mail is the SMTP server sentry sends emails through (defaults: emails aren't sent)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.MailSpec"),
+						},
+					},
+					"filestore": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Filestore is where uploaded files such as attachments, source maps and debug files are kept (defaults: the filesystem of each pod, which isn't shared between replicas)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.FilestoreSpec"),
+						},
+					},
+					"retention": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Retention runs sentry cleanup periodically to delete data older than a number of days (defaults: disabled, data is kept forever)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RetentionSpec"),
+						},
+					},
+					"snuba": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Snuba deploys the snuba services sentry 10 and later store and search events with, it requires Kafka (defaults: disabled, the sentry 9 topology)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SnubaSpec"),
+						},
+					},
+					"kafka": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kafka is the cluster events go through on their way to snuba",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.KafkaSpec"),
+						},
+					},
+					"relay": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Relay deploys relay in front of sentry to ingest events, it requires snuba (defaults: events are sent to the web pods)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RelaySpec"),
+						},
+					},
+					"ingress": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Ingress exposes sentry at a host name, the ingest endpoints go to relay when it's deployed (defaults: not exposed)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.IngressSpec"),
+						},
+					},
+					"symbolicator": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Symbolicator deploys symbolicator to process native crashes with debug symbols (defaults: disabled)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SymbolicatorSpec"),
+						},
+					},
+					"rollouts": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Rollouts tunes how the deployment of each component replaces its pods (defaults: the kubernetes defaults, cron is always recreated)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutsSpec"),
+						},
+					},
+					"upgradeBackup": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UpgradeBackup takes a SentryBackup before the migrations of a new sentryImage run (defaults: disabled)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.UpgradeBackupSpec"),
+						},
+					},
+					"upgrade": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Upgrade selects how the sentry processes move to a new sentryImage once its migrations ran",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.UpgradeSpec"),
+						},
+					},
+					"canary": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Canary runs a few web pods on a candidate image behind the web service, promoting it to sentryImage once they stayed healthy (defaults: disabled)",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CanarySpec"),
+						},
+					},
+				},
+				Required: []string{"postgresHost", "postgresDB"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CanarySpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CertificateSource", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.FilestoreSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.IngressSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.KafkaSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.MailSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.MemcachedSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RedisSentinelSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RelaySpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RetentionSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.RolloutsSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryConfigSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SnubaSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SymbolicatorSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.UpgradeBackupSpec", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.UpgradeSpec", "k8s.io/api/core/v1.SecretKeySelector"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SentryStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SentryStatus defines the observed state of Sentry",
+				Properties: map[string]spec.Schema{
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"conditions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Conditions are the latest observations of the instance and its dependencies",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryCondition"),
+									},
+								},
+							},
+						},
+					},
+					"migratedImage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MigratedImage is the last image whose migrations completed",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"migratedVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MigratedVersion is the sentry version of MigratedImage",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"redisMaster": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RedisMaster is the host:port of the redis master sentinel last reported, the pods fall back to it when they can't reach sentinel",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"imageVersions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ImageVersions are the sentry versions found for the migrated and the target image",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"failedImage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "FailedImage is the image whose migrations failed and were rolled back, the deployments stay on MigratedImage until sentryImage changes",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"upgradeBackup": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UpgradeBackup is the name of the SentryBackup taken before the last upgrade",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"missingKafkaTopics": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MissingKafkaTopics are the topics the last check couldn't find or create",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"snubaMigratedImage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SnubaMigratedImage is the last snuba image whose migrations completed",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"cleanup": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Cleanup describes the last run of the retention cleanup",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CleanupStatus"),
+						},
+					},
+					"secretKeyRotation": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SecretKeyRotation describes the last rotation of the secret key",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SecretKeyRotationStatus"),
+						},
+					},
+					"stalledRollouts": {
+						SchemaProps: spec.SchemaProps{
+							Description: "StalledRollouts are the deployments whose rollout exceeded its progress deadline",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"blueGreen": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BlueGreen describes the sets of web, worker and cron deployments of the BlueGreen upgrade strategy",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.BlueGreenStatus"),
+						},
+					},
+					"canary": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Canary describes the canary of the last candidate image",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CanaryStatus"),
+						},
+					},
+				},
+				Required: []string{"status"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.BlueGreenStatus", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CanaryStatus", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.CleanupStatus", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SecretKeyRotationStatus", "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SentryCondition"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SnubaSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SnubaSpec defines the snuba services",
+				Properties: map[string]spec.Schema{
+					"image": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Image is the image of snuba we are running (defaults: docker.io/getsentry/snuba:latest)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiReplicas": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIReplicas is the number of snuba api replicas (defaults: 1)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"consumerReplicas": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ConsumerReplicas is the number of replicas of each kafka consumer, more than the partitions of their topic sit idle (defaults: 1)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"clickhouse": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClickHouse is the server snuba stores events in",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.ClickHouseSpec"),
+						},
+					},
+				},
+				Required: []string{"clickhouse"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.ClickHouseSpec"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SymbolSourceSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SymbolSourceSpec defines an external symbol server",
+				Properties: map[string]spec.Schema{
+					"id": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ID identifies the source in the project settings",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Name is shown in the project settings (defaults: ID)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"url": {
+						SchemaProps: spec.SchemaProps{
+							Description: "URL is the HTTP address of the symbol server",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"layout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Layout is the directory layout of the server, one of native, symstore, symstore_index2, ssqp or unified (defaults: native)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"id", "url"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_SymbolicatorSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SymbolicatorSpec defines the symbolicator deployment",
+				Properties: map[string]spec.Schema{
+					"image": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Image is the image of symbolicator we are running (defaults: docker.io/getsentry/symbolicator:latest)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"replicas": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Replicas is the number of symbolicator replicas, each with its own cache (defaults: 1)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"cacheSize": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CacheSize is the size of the claim symbols are cached on (defaults: 10Gi)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"storageClassName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "StorageClassName is the storage class of the cache claim (defaults: the cluster default)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"resources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Resources are the resources of the symbolicator container",
+							Ref:         ref("k8s.io/api/core/v1.ResourceRequirements"),
+						},
+					},
+					"sources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Sources are external symbol servers added to the built-in sources of sentry, they're enabled on projects created afterwards",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SymbolSourceSpec"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.SymbolSourceSpec", "k8s.io/api/core/v1.ResourceRequirements"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_UpgradeBackupSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "UpgradeBackupSpec defines the backups taken before migrating to a new image",
+				Properties: map[string]spec.Schema{
+					"storage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Storage is where the dumps are written",
+							Ref:         ref("github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.BackupStorage"),
+						},
+					},
+					"prefix": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Prefix is the directory or key prefix the dumps are written under (defaults: <name of the Sentry instance>/pre-upgrade)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"retention": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Retention is the number of pre-upgrade dumps kept under Prefix, the retention of other backups never drops them (defaults: 0, keep everything)",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"rollbackOnFailure": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RollbackOnFailure restores the backup and pins the deployments back to the previous image when the migrations fail",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"storage"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1.BackupStorage"},
+	}
+}
+
+func schema_pkg_apis_sentry_v1alpha1_UpgradeSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "UpgradeSpec defines how the sentry processes move to a new image",
+				Properties: map[string]spec.Schema{
+					"strategy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Strategy is InPlace, rolling the processes to the new image, or BlueGreen, bringing up a second set of web, worker and cron on it and switching the web service over once it's ready; the consumers are always rolled in place (defaults: InPlace)",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"previousSetRetentionSeconds": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PreviousSetRetentionSeconds is how long the previous set is kept scaled down after a blue/green switch, setting sentryImage back to its image in the meantime switches back to it without migrating, as long as its version runs on the migrated schema or the allow-version-skew annotation names it (defaults: 86400)",
+							Type:        []string{"integer"},
+							Format:      "int32",
 						},
 					},
 				},
-				Required: []string{"status"},
 			},
 		},
 		Dependencies: []string{},
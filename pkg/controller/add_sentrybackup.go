@@ -0,0 +1,10 @@
+package controller
+
+import (
+	"github.com/sd-hackday-sentry/sentry-operator/pkg/controller/sentrybackup"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to create controllers and add them to a manager.
+	AddToManagerFuncs = append(AddToManagerFuncs, sentrybackup.Add)
+}
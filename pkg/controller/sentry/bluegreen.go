@@ -0,0 +1,215 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	colorBlue  = "blue"
+	colorGreen = "green"
+	// the green set is named after the blue one, which keeps the names the
+	// processes had before blue/green upgrades were enabled
+	greenSuffix = "-green"
+)
+
+// the processes brought up a second time by a blue/green upgrade
+var blueGreenProcesses = []string{"sentry-web-ui", "sentry-worker", cronName}
+
+// returns the name of a process in the set of the given color
+func coloredName(name, color string) string {
+	if color == colorGreen {
+		return name + greenSuffix
+	}
+	return name
+}
+
+// returns the name of a process whatever its set
+func baseName(name string) string {
+	return strings.TrimSuffix(name, greenSuffix)
+}
+
+func otherColor(color string) string {
+	if color == colorGreen {
+		return colorBlue
+	}
+	return colorGreen
+}
+
+// returns the color of the set the web service points at
+func (r *ReconcileSentry) activeColor() string {
+	if bg := r.sentry.Status.BlueGreen; bg != nil {
+		return bg.ActiveColor
+	}
+	return colorBlue
+}
+
+// returns whether image is the one of the previous set, which is switched
+// back to without running its migrations again
+func (r *ReconcileSentry) blueGreenRollback(image string) bool {
+	bg := r.sentry.Status.BlueGreen
+	return r.sentry.Spec.Upgrade.Strategy == v1alpha1.UpgradeBlueGreen &&
+		bg != nil && bg.PreviousImage != "" && bg.PreviousImage == image && bg.ActiveImage != image
+}
+
+// moves a deployment built for the blue set to the given set and image
+func recolor(dep *appsv1.Deployment, color, image string) {
+	name := coloredName(dep.Name, color)
+	labels := map[string]string{"app": name}
+	dep.Name = name
+	dep.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	dep.Spec.Template.Labels = labels
+	dep.Spec.Template.Spec.Containers[0].Image = image
+}
+
+// returns the deployments of the web, worker and cron of each set that
+// should exist
+func (r *ReconcileSentry) sentryDeployments() []func() *appsv1.Deployment {
+	builders := []func() *appsv1.Deployment{
+		r.deploymentForSentryWebUI,
+		r.deploymentForSentryWorker,
+		r.deploymentForSentryCron,
+	}
+	bg := r.sentry.Status.BlueGreen
+	if bg == nil {
+		return builders
+	}
+
+	image := r.runningImage()
+	inactive := otherColor(bg.ActiveColor)
+	deployments := []func() *appsv1.Deployment{}
+	for _, f := range builders {
+		f := f
+		deployments = append(deployments, func() *appsv1.Deployment {
+			dep := f()
+			recolor(dep, bg.ActiveColor, bg.ActiveImage)
+			return dep
+		})
+		switch {
+		case image != bg.ActiveImage:
+			// the set being switched to, its cron only starts once the
+			// active one stops
+			deployments = append(deployments, func() *appsv1.Deployment {
+				dep := f()
+				recolor(dep, inactive, image)
+				if baseName(dep.Name) == cronName {
+					zero := int32(0)
+					dep.Spec.Replicas = &zero
+				}
+				return dep
+			})
+		case bg.PreviousImage != "":
+			// the previous set, kept around for a rollback
+			deployments = append(deployments, func() *appsv1.Deployment {
+				dep := f()
+				recolor(dep, inactive, bg.PreviousImage)
+				zero := int32(0)
+				dep.Spec.Replicas = &zero
+				return dep
+			})
+		}
+	}
+	return deployments
+}
+
+// follows a blue/green upgrade: switches the web service to the other set
+// once it runs the new image, and drops the previous set once it's been
+// kept long enough; returns whether an upgrade is underway
+func (r *ReconcileSentry) planBlueGreen() (bool, error) {
+	status := &r.sentry.Status
+	upgrade := r.sentry.Spec.Upgrade
+	image := r.runningImage()
+	bg := status.BlueGreen
+
+	if upgrade.Strategy != v1alpha1.UpgradeBlueGreen {
+		if bg == nil {
+			return false, nil
+		}
+		// the active set is upgraded in place, whatever its color
+		bg.ActiveImage = image
+		bg.PreviousImage = ""
+		bg.Message = ""
+		return false, r.deleteSet(otherColor(bg.ActiveColor))
+	}
+
+	if bg == nil {
+		bg = &v1alpha1.BlueGreenStatus{
+			ActiveColor: colorBlue,
+			ActiveImage: image,
+		}
+		status.BlueGreen = bg
+	}
+
+	if image == bg.ActiveImage {
+		if bg.PreviousImage != "" && bg.SwitchTime != nil {
+			retention := time.Duration(upgrade.PreviousSetRetentionSeconds) * time.Second
+			if time.Since(bg.SwitchTime.Time) < retention {
+				bg.Message = fmt.Sprintf("keeping the %s set on %s scaled down until %s", otherColor(bg.ActiveColor), bg.PreviousImage, bg.SwitchTime.Add(retention).Format(time.RFC3339))
+				return false, nil
+			}
+			r.recorder.Eventf(r.sentry, corev1.EventTypeNormal, "PreviousSetDeleted", "Deleting the %s set on %s, it can't be switched back to anymore", otherColor(bg.ActiveColor), bg.PreviousImage)
+			bg.PreviousImage = ""
+		}
+		bg.Message = ""
+		return false, r.deleteSet(otherColor(bg.ActiveColor))
+	}
+
+	inactive := otherColor(bg.ActiveColor)
+	for _, name := range blueGreenProcesses {
+		if name == cronName {
+			continue
+		}
+		name = coloredName(name, inactive)
+		dep := &appsv1.Deployment{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: r.sentry.Namespace}, dep)
+		if err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "Failed to get Deployment.", "Deployment.Name", name)
+			return false, err
+		}
+		if err != nil || dep.Spec.Template.Spec.Containers[0].Image != image || dep.Spec.Replicas == nil || *dep.Spec.Replicas == 0 || !RolledOut(dep) {
+			bg.Message = fmt.Sprintf("waiting for %s to run %s", name, image)
+			return true, nil
+		}
+	}
+
+	message := fmt.Sprintf("switched the web service from the %s set on %s to the %s set on %s", bg.ActiveColor, bg.ActiveImage, inactive, image)
+	r.recorder.Event(r.sentry, corev1.EventTypeNormal, "Switched", message)
+	now := metav1.Now()
+	bg.PreviousImage = bg.ActiveImage
+	bg.ActiveImage = image
+	bg.ActiveColor = inactive
+	bg.SwitchTime = &now
+	bg.Message = message
+	return false, nil
+}
+
+// deletes the web, worker and cron deployments of a set
+func (r *ReconcileSentry) deleteSet(color string) error {
+	for _, name := range blueGreenProcesses {
+		name = coloredName(name, color)
+		dep := &appsv1.Deployment{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: r.sentry.Namespace}, dep)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			r.logger.Error(err, "Failed to get Deployment.", "Deployment.Name", name)
+			return err
+		}
+		r.logger.Info("Deleting Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+		if err := r.client.Delete(context.TODO(), dep); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "Failed to delete Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			return err
+		}
+	}
+	return nil
+}
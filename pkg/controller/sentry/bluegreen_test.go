@@ -0,0 +1,49 @@
+package sentry
+
+import (
+	"testing"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestBlueGreenRollbackVersionSkew(t *testing.T) {
+	tests := []struct {
+		name        string
+		previous    string
+		annotations map[string]string
+		want        string
+	}{
+		{"same version", "getsentry/sentry:24.8.0-py3", nil, ""},
+		{"downgrade", "getsentry/sentry:23.11.0", nil, "VersionSkewBlocked"},
+		{
+			"allowed downgrade",
+			"getsentry/sentry:23.11.0",
+			map[string]string{v1alpha1.AllowVersionSkewAnnotation: "getsentry/sentry:23.11.0"},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := reconcilerFor(v1alpha1.SentrySpec{
+				RedisHost:   "redis",
+				SentryImage: tt.previous,
+				Upgrade:     v1alpha1.UpgradeSpec{Strategy: v1alpha1.UpgradeBlueGreen},
+			})
+			r.recorder = record.NewFakeRecorder(10)
+			r.sentry.Annotations = tt.annotations
+			r.sentry.Status.MigratedImage = "getsentry/sentry:24.8.0"
+			r.sentry.Status.MigratedVersion = "24.8.0"
+			r.sentry.Status.BlueGreen = &v1alpha1.BlueGreenStatus{
+				ActiveColor:   "green",
+				ActiveImage:   "getsentry/sentry:24.8.0",
+				PreviousImage: tt.previous,
+			}
+
+			phase, err := r.migrate()
+			if err != nil || phase != tt.want {
+				t.Errorf("migrate() = %q, %v, want %q", phase, err, tt.want)
+			}
+		})
+	}
+}
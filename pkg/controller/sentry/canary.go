@@ -0,0 +1,352 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	canaryName = "sentry-web-ui-canary"
+	// job listing the migrations of the candidate the database lacks
+	canaryMigrationsJobName = "sentry-canary-migrations"
+	// label of the canary pods, they share the app label of the web pods so
+	// the web service sends them their share of the traffic
+	canaryLabel = "sentry.redhat.com/canary"
+)
+
+// returns the number of canary web pods
+func canaryReplicas(spec *v1alpha1.SentrySpec) int32 {
+	replicas := (spec.SentryWebReplicas*spec.Canary.Share + 99) / 100
+	if replicas < 1 {
+		replicas = 1
+	}
+	return int32(replicas)
+}
+
+// counts the migrations of the image the database lacks and names the first
+// few of them
+const canaryMigrationsScript = `set -e
+sentry django showmigrations --plan > /tmp/plan
+grep -c '^\[ \]' /tmp/plan > /dev/termination-log || true
+grep '^\[ \]' /tmp/plan | head -n 5 >> /dev/termination-log || true
+`
+
+// job listing the migrations of the candidate image that weren't applied to
+// the database
+func (r *ReconcileSentry) jobForCanaryMigrations() *batchv1.Job {
+	name := canaryMigrationsJobName
+	restartPolicy := corev1.RestartPolicyNever
+	zero := int32(0)
+	deadline := int64(300)
+	opts := templateOpts{
+		Name: name,
+		Args: []string{
+			"/bin/sh",
+			"-c",
+			canaryMigrationsScript,
+		},
+		RestartPolicy: &restartPolicy,
+	}
+	template := r.getCommonPodTemplate(opts)
+	template.Spec.Containers[0].Image = r.sentry.Spec.Canary.Image
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.sentry.Namespace,
+			Annotations: map[string]string{
+				// the plan is compared to the schema of the migrated image
+				hashAnnotation: hashOf(r.sentry.Status.MigratedImage),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template:              template,
+			BackoffLimit:          &zero,
+			ActiveDeadlineSeconds: &deadline,
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, job, r.scheme)
+	return job
+}
+
+// deployment for the canary web pods, running the candidate image next to
+// the web pods of the active set
+func (r *ReconcileSentry) deploymentForSentryWebUICanary() *appsv1.Deployment {
+	dep := r.deploymentForSentryWebUI()
+	r.applyRollout(dep)
+	labels := map[string]string{
+		"app":       coloredName(dep.Name, r.activeColor()),
+		canaryLabel: "true",
+	}
+	replicas := canaryReplicas(&r.sentry.Spec)
+	dep.Name = canaryName
+	dep.Spec.Replicas = &replicas
+	dep.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	dep.Spec.Template.Labels = labels
+	dep.Spec.Template.Spec.Containers[0].Image = r.sentry.Spec.Canary.Image
+	return dep
+}
+
+// runs the canary of the candidate image and decides on it: it's aborted
+// when its pods restart too often or its rollout stalls, and promoted to
+// sentryImage once its pods stayed healthy long enough; returns the phase to
+// report while it runs
+func (r *ReconcileSentry) canary(upgrading bool) (string, error) {
+	status := &r.sentry.Status
+	c := r.sentry.Spec.Canary
+
+	if c == nil || c.Image == r.sentry.Spec.SentryImage {
+		if s := status.Canary; s != nil && s.Phase == "Progressing" {
+			s.Phase = "Aborted"
+			s.Message = "the canary was removed from the spec"
+		}
+		return "", r.deleteCanary()
+	}
+
+	s := status.Canary
+	if s == nil || s.Image != c.Image {
+		s = &v1alpha1.CanaryStatus{
+			Image: c.Image,
+			Phase: "Progressing",
+		}
+		status.Canary = s
+	}
+	switch s.Phase {
+	case "Aborted":
+		// waiting for another candidate
+		return "", r.deleteCanary()
+	case "Promoted":
+		// the spec update failed last time
+		return "CanaryPromoted", r.promoteCanary()
+	}
+
+	// the database isn't migrated for the candidate
+	if phase, err := r.canarySchemaCompatible(); phase != "" || err != nil || s.Phase == "Aborted" {
+		return phase, err
+	}
+
+	dep := r.deploymentForSentryWebUICanary()
+	found := &appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: dep.Name, Namespace: dep.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		r.logger.Info("Creating a new Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+		if err := r.client.Create(context.TODO(), dep); err != nil {
+			r.logger.Error(err, "Failed to create new Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			return "", err
+		}
+		s.Message = fmt.Sprintf("starting %d canary web pods on %s", *dep.Spec.Replicas, c.Image)
+		return "Canary", nil
+	} else if err != nil {
+		r.logger.Error(err, "Failed to get Deployment.", "Deployment.Name", dep.Name)
+		return "", err
+	}
+	if !reflect.DeepEqual(found.Spec.Selector, dep.Spec.Selector) {
+		// the web service moved to another set, the selector can't follow
+		s.ReadyTime = nil
+		s.Message = "restarting the canary with the web pods of the active set"
+		return "Canary", r.deleteCanary()
+	}
+	r.logger.Info("Deployment already exists, updating to reconcile", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+	if err := r.client.Update(context.TODO(), dep); err != nil {
+		r.logger.Error(err, "Failed to update Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+		return "", err
+	}
+
+	restarts, err := r.canaryRestarts()
+	if err != nil {
+		return "", err
+	}
+	s.Restarts = restarts
+	if restarts > *c.MaxRestarts {
+		return "", r.abortCanary(fmt.Sprintf("the canary pods restarted %d times, more than the %d tolerated", restarts, *c.MaxRestarts))
+	}
+	if rolloutStalled(found) {
+		return "", r.abortCanary("the rollout of the canary pods exceeded its progress deadline")
+	}
+
+	if !RolledOut(found) || found.Spec.Template.Spec.Containers[0].Image != c.Image {
+		s.ReadyTime = nil
+		s.Message = fmt.Sprintf("waiting for the canary web pods to be ready on %s", c.Image)
+		return "Canary", nil
+	}
+	if s.ReadyTime == nil {
+		now := metav1.Now()
+		s.ReadyTime = &now
+	}
+	analysis := time.Duration(c.AnalysisSeconds) * time.Second
+	if time.Since(s.ReadyTime.Time) < analysis || upgrading {
+		// an upgrade of the web pods underway is waited for, the candidate
+		// is compared to the set it would replace
+		s.Message = fmt.Sprintf("the canary web pods are healthy, promoting %s at %s", c.Image, s.ReadyTime.Add(analysis).Format(time.RFC3339))
+		return "Canary", nil
+	}
+
+	s.Phase = "Promoted"
+	s.Message = fmt.Sprintf("the canary web pods stayed healthy for %s, promoted %s to sentryImage", analysis, c.Image)
+	r.recorder.Event(r.sentry, corev1.EventTypeNormal, "CanaryPromoted", s.Message)
+	// recorded first, the spec update makes the status we hold stale
+	if err := r.updateStatus("PromotingCanary"); err != nil {
+		return "", err
+	}
+	return "CanaryPromoted", r.promoteCanary()
+}
+
+// makes sure the candidate runs on the current schema: its version has to be
+// one the migrated version can be used by, and it can't bring migrations the
+// database lacks; aborts the canary otherwise, returns the phase to report
+// until it's known
+func (r *ReconcileSentry) canarySchemaCompatible() (string, error) {
+	s := r.sentry.Status.Canary
+	image := r.sentry.Spec.Canary.Image
+
+	problem, phase, err := r.canaryVersionProblem(image)
+	if phase != "" || err != nil {
+		s.Message = fmt.Sprintf("inspecting the version of %s", image)
+		return "Canary", err
+	}
+	if problem != "" {
+		return "", r.abortCanary(problem)
+	}
+
+	job, state, err := r.getJobState(canaryMigrationsJobName)
+	if err != nil {
+		return "", err
+	}
+	if job != nil && (jobImage(job) != image || job.Annotations[hashAnnotation] != hashOf(r.sentry.Status.MigratedImage)) {
+		// left over by another candidate or schema
+		s.Message = fmt.Sprintf("listing the migrations of %s", image)
+		return "Canary", r.deleteJob(job)
+	}
+	switch state {
+	case JobMissing:
+		job = r.jobForCanaryMigrations()
+		r.logger.Info("Creating a new Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.client.Create(context.TODO(), job); err != nil {
+			r.logger.Error(err, "Failed to create Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return "", err
+		}
+		fallthrough
+	case JobRunning:
+		s.Message = fmt.Sprintf("listing the migrations of %s", image)
+		return "Canary", nil
+	case JobFailed:
+		return "", r.abortCanary(fmt.Sprintf("the migrations of %s couldn't be listed, see the logs of job %s", image, canaryMigrationsJobName))
+	}
+
+	// the job is kept as the record of the check until the canary ends
+	lines := strings.Split(strings.TrimSpace(r.jobTerminationMessage(canaryMigrationsJobName)), "\n")
+	if pending, _ := strconv.Atoi(strings.TrimSpace(lines[0])); pending > 0 {
+		return "", r.abortCanary(fmt.Sprintf("%s needs %d migrations the database lacks, upgrade sentryImage to it instead: %s", image, pending, strings.Join(lines[1:], ", ")))
+	}
+	return "", nil
+}
+
+// returns why the version of the candidate can't run on the current schema,
+// empty when it can or the skew annotation allows it; returns the phase to
+// report instead until the versions are known
+func (r *ReconcileSentry) canaryVersionProblem(image string) (string, string, error) {
+	reason, message, phase, err := r.versionProblem(image)
+	if phase != "" || err != nil {
+		return "", phase, err
+	}
+	switch reason {
+	case "Downgrade", "UnsupportedUpgrade", "UnknownVersion":
+		if r.sentry.Annotations[v1alpha1.AllowVersionSkewAnnotation] != image {
+			return message, "", nil
+		}
+	}
+	return "", "", nil
+}
+
+// returns the container restarts of the canary pods
+func (r *ReconcileSentry) canaryRestarts() (int32, error) {
+	pods := &corev1.PodList{}
+	opts := client.InNamespace(r.sentry.Namespace).MatchingLabels(map[string]string{canaryLabel: "true"})
+	if err := r.client.List(context.TODO(), opts, pods); err != nil {
+		r.logger.Error(err, "Failed to list the canary Pods.")
+		return 0, err
+	}
+	restarts := int32(0)
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			restarts += cs.RestartCount
+		}
+	}
+	return restarts, nil
+}
+
+// gives up on the candidate until the canary image changes
+func (r *ReconcileSentry) abortCanary(message string) error {
+	s := r.sentry.Status.Canary
+	s.Phase = "Aborted"
+	s.Message = message
+	r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "CanaryAborted", "Aborted the canary of %s: %s", s.Image, message)
+	return r.deleteCanary()
+}
+
+// makes the candidate the sentryImage, the next reconcile upgrades to it
+// with the upgrade strategy of the spec
+func (r *ReconcileSentry) promoteCanary() error {
+	// the spec we hold has its defaults filled in, only the fields changed
+	// here are written
+	latest := &v1alpha1.Sentry{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: r.sentry.Name, Namespace: r.sentry.Namespace}, latest); err != nil {
+		return err
+	}
+	if latest.Spec.Canary == nil || latest.Spec.Canary.Image != r.sentry.Status.Canary.Image {
+		// the canary changed meanwhile
+		return nil
+	}
+	latest.Spec.SentryImage = latest.Spec.Canary.Image
+	latest.Spec.Canary = nil
+	r.logger.Info("Promoting the canary image.", "Image", latest.Spec.SentryImage)
+	if err := r.client.Update(context.TODO(), latest); err != nil {
+		r.logger.Error(err, "Failed to update Sentry.")
+		return err
+	}
+	return nil
+}
+
+// deletes the canary web pods and the job listing the migrations of the
+// candidate
+func (r *ReconcileSentry) deleteCanary() error {
+	job, _, err := r.getJobState(canaryMigrationsJobName)
+	if err != nil {
+		return err
+	}
+	if job != nil {
+		if err := r.deleteJob(job); err != nil {
+			return err
+		}
+	}
+
+	dep := &appsv1.Deployment{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: canaryName, Namespace: r.sentry.Namespace}, dep)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		r.logger.Error(err, "Failed to get Deployment.", "Deployment.Name", canaryName)
+		return err
+	}
+	r.logger.Info("Deleting Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+	if err := r.client.Delete(context.TODO(), dep); err != nil && !errors.IsNotFound(err) {
+		r.logger.Error(err, "Failed to delete Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package sentry
+
+import (
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+)
+
+func TestCanaryVersionProblem(t *testing.T) {
+	// want is empty when the canary goes ahead, otherwise a part of the
+	// reason it's aborted
+	tests := []struct {
+		name        string
+		image       string
+		annotations map[string]string
+		want        string
+	}{
+		{"same version", "getsentry/sentry:23.6.2", nil, ""},
+		{"same version, other tag", "getsentry/sentry:23.6.2-py3", nil, ""},
+		{"patch release", "getsentry/sentry:23.6.3", nil, ""},
+		{"up to the next hard stop", "getsentry/sentry:23.11.0", nil, ""},
+		{"downgrade", "getsentry/sentry:23.6.1", nil, "older than the migrated version"},
+		{"skips a hard stop", "getsentry/sentry:24.1.0", nil, "upgrade to 23.11.0 first"},
+		{"unknown version", "getsentry/sentry:nightly", nil, "couldn't be found"},
+		{
+			"allowed skew",
+			"getsentry/sentry:24.1.0",
+			map[string]string{v1alpha1.AllowVersionSkewAnnotation: "getsentry/sentry:24.1.0"},
+			"",
+		},
+		{
+			"skew allowed for another image",
+			"getsentry/sentry:24.1.0",
+			map[string]string{v1alpha1.AllowVersionSkewAnnotation: "getsentry/sentry:24.2.0"},
+			"upgrade to 23.11.0 first",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := reconcilerFor(v1alpha1.SentrySpec{
+				RedisHost:   "redis",
+				SentryImage: "getsentry/sentry:23.6.2",
+				Canary:      &v1alpha1.CanarySpec{Image: tt.image},
+			})
+			r.sentry.Annotations = tt.annotations
+			r.sentry.Status.MigratedImage = "getsentry/sentry:23.6.2"
+			r.sentry.Status.MigratedVersion = "23.6.2"
+			// already inspected, it didn't tell its version
+			r.sentry.Status.ImageVersions = map[string]string{"getsentry/sentry:nightly": ""}
+
+			got, phase, err := r.canaryVersionProblem(tt.image)
+			if err != nil || phase != "" {
+				t.Fatalf("canaryVersionProblem(%q) returned phase %q, error %v", tt.image, phase, err)
+			}
+			if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+				t.Errorf("canaryVersionProblem(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
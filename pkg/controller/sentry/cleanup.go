@@ -0,0 +1,175 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const cleanupName = "sentry-cleanup"
+
+// cronjob for the sentry cleanup process
+func (r *ReconcileSentry) cronJobForSentryCleanup() *batchv1beta1.CronJob {
+	rt := r.sentry.Spec.Retention
+	restartPolicy := corev1.RestartPolicyNever
+	suspend := false
+	// the next run picks up where a failed one stopped
+	zero := int32(0)
+	opts := templateOpts{
+		Name: cleanupName,
+		Args: []string{
+			"cleanup",
+			"--days",
+			fmt.Sprintf("%d", rt.Days),
+			"--concurrency",
+			fmt.Sprintf("%d", rt.Concurrency),
+		},
+		RestartPolicy: &restartPolicy,
+		Resources:     rt.Resources,
+	}
+	labels := map[string]string{"app": cleanupName}
+	cronJob := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cleanupName,
+			Namespace: r.sentry.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:                   rt.Schedule,
+			ConcurrencyPolicy:          batchv1beta1.ForbidConcurrent,
+			Suspend:                    &suspend,
+			SuccessfulJobsHistoryLimit: rt.SuccessfulJobsHistoryLimit,
+			FailedJobsHistoryLimit:     rt.FailedJobsHistoryLimit,
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &zero,
+					Template:     r.getCommonPodTemplate(opts),
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, cronJob, r.scheme)
+	return cronJob
+}
+
+// creates, updates or deletes the cleanup cronjob to match the retention
+// and records how its last run went
+func (r *ReconcileSentry) cleanup() error {
+	found := &batchv1beta1.CronJob{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: cleanupName, Namespace: r.sentry.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		r.logger.Error(err, "Failed to get CronJob.", "CronJob.Name", cleanupName)
+		return err
+	}
+	exists := err == nil
+
+	if r.sentry.Spec.Retention == nil {
+		r.sentry.Status.Cleanup = nil
+		if !exists {
+			return nil
+		}
+		r.logger.Info("Deleting CronJob.", "CronJob.Namespace", found.Namespace, "CronJob.Name", found.Name)
+		err := r.client.Delete(context.TODO(), found, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "Failed to delete CronJob.", "CronJob.Namespace", found.Namespace, "CronJob.Name", found.Name)
+			return err
+		}
+		return nil
+	}
+
+	cronJob := r.cronJobForSentryCleanup()
+	if !exists {
+		r.logger.Info("Creating a new CronJob.", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+		if err := r.client.Create(context.TODO(), cronJob); err != nil {
+			r.logger.Error(err, "Failed to create new CronJob.", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+			return err
+		}
+		return nil
+	}
+	r.logger.Info("CronJob already exists, updating to reconcile", "CronJob.Namespace", found.Namespace, "CronJob.Name", found.Name)
+	if err := r.client.Update(context.TODO(), cronJob); err != nil {
+		r.logger.Error(err, "Failed to update CronJob.", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+		return err
+	}
+	return r.cleanupStatus(found)
+}
+
+// records the last run of the cleanup from the jobs the cronjob kept around
+func (r *ReconcileSentry) cleanupStatus(cronJob *batchv1beta1.CronJob) error {
+	jobs := &batchv1.JobList{}
+	opts := client.InNamespace(r.sentry.Namespace).MatchingLabels(map[string]string{"app": cleanupName})
+	if err := r.client.List(context.TODO(), opts, jobs); err != nil {
+		r.logger.Error(err, "Failed to list the cleanup Jobs.")
+		return err
+	}
+
+	status := r.sentry.Status.Cleanup
+	if status == nil {
+		status = &v1alpha1.CleanupStatus{}
+	}
+	status.LastScheduleTime = cronJob.Status.LastScheduleTime
+
+	var last *batchv1.Job
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if last == nil || last.CreationTimestamp.Before(&job.CreationTimestamp) {
+			last = job
+		}
+		if jobStateOf(job) == JobComplete && job.Status.CompletionTime != nil {
+			if status.LastSuccessTime == nil || status.LastSuccessTime.Before(job.Status.CompletionTime) {
+				status.LastSuccessTime = job.Status.CompletionTime
+			}
+		}
+	}
+	if last != nil {
+		status.LastJob = last.Name
+		switch jobStateOf(last) {
+		case JobComplete:
+			status.LastResult = "Succeeded"
+		case JobFailed:
+			status.LastResult = "Failed"
+		default:
+			status.LastResult = "Running"
+		}
+	}
+	r.sentry.Status.Cleanup = status
+	return nil
+}
+
+// suspends the cleanup cronjob so nothing touches the database while the
+// instance is paused, the next reconcile of a resumed instance undoes it
+func (r *ReconcileSentry) suspendCleanup() error {
+	cronJob := &batchv1beta1.CronJob{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: cleanupName, Namespace: r.sentry.Namespace}, cronJob)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		r.logger.Error(err, "Failed to get CronJob.", "CronJob.Name", cleanupName)
+		return err
+	}
+	if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+		return nil
+	}
+	r.logger.Info("Suspending CronJob.", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+	suspend := true
+	cronJob.Spec.Suspend = &suspend
+	if err := r.client.Update(context.TODO(), cronJob); err != nil {
+		r.logger.Error(err, "Failed to update CronJob.", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+		return err
+	}
+	return nil
+}
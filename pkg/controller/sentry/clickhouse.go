@@ -0,0 +1,227 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const clickHouseName = "sentry-clickhouse"
+
+// returns the name of the server snuba reaches ClickHouse at
+func clickHouseHost(c *v1alpha1.ClickHouseSpec) string {
+	if c.Managed() {
+		return clickHouseName
+	}
+	return c.Host
+}
+
+// statefulset for the managed ClickHouse server
+func (r *ReconcileSentry) statefulSetForClickHouse() *appsv1.StatefulSet {
+	c := r.sentry.Spec.Snuba.ClickHouse
+	replicas := int32(1)
+	labels := map[string]string{"app": clickHouseName}
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clickHouseName,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: clickHouseName,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image: c.Image,
+						Name:  clickHouseName,
+						Ports: []corev1.ContainerPort{
+							{
+								Name:          "native",
+								ContainerPort: int32(c.Port),
+								Protocol:      "TCP",
+							},
+							{
+								Name:          "http",
+								ContainerPort: int32(c.HTTPPort),
+								Protocol:      "TCP",
+							},
+						},
+						Resources: c.Resources,
+						ReadinessProbe: &corev1.Probe{
+							InitialDelaySeconds: int32(5),
+							Handler: corev1.Handler{
+								HTTPGet: &corev1.HTTPGetAction{
+									Path: "/ping",
+									Port: intstr.IntOrString{
+										IntVal: int32(c.HTTPPort),
+									},
+									Scheme: "HTTP",
+								},
+							},
+							PeriodSeconds: int32(10),
+						},
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      "data",
+								MountPath: "/var/lib/clickhouse",
+							},
+						},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "data",
+					Labels: labels,
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					StorageClassName: c.StorageClassName,
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: resource.MustParse(c.StorageSize),
+						},
+					},
+				},
+			}},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, sts, r.scheme)
+	return sts
+}
+
+// service for the managed ClickHouse server
+func (r *ReconcileSentry) serviceForClickHouse() *corev1.Service {
+	c := r.sentry.Spec.Snuba.ClickHouse
+	labels := map[string]string{"app": clickHouseName}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:    labels,
+			Name:      clickHouseName,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:     "native",
+					Port:     int32(c.Port),
+					Protocol: "TCP",
+				},
+				{
+					Name:     "http",
+					Port:     int32(c.HTTPPort),
+					Protocol: "TCP",
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, svc, r.scheme)
+	return svc
+}
+
+// creates or updates the managed ClickHouse server, the claims of an existing
+// statefulset can't change so only its pod template is updated
+func (r *ReconcileSentry) reconcileClickHouse() error {
+	sts := r.statefulSetForClickHouse()
+	found := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		r.logger.Info("Creating a new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+		if err := r.client.Create(context.TODO(), sts); err != nil {
+			r.logger.Error(err, "Failed to create new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+			return err
+		}
+	} else if err != nil {
+		r.logger.Error(err, "Failed to get StatefulSet.", "StatefulSet.Name", sts.Name)
+		return err
+	} else {
+		r.logger.Info("StatefulSet already exists, updating to reconcile", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+		found.Spec.Template = sts.Spec.Template
+		if err := r.client.Update(context.TODO(), found); err != nil {
+			r.logger.Error(err, "Failed to update StatefulSet.", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+			return err
+		}
+	}
+
+	svc := r.serviceForClickHouse()
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, &corev1.Service{})
+	if err != nil && errors.IsNotFound(err) {
+		r.logger.Info("Creating a new Service.", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+		if err := r.client.Create(context.TODO(), svc); err != nil {
+			r.logger.Error(err, "Failed to create new Service.", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+			return err
+		}
+	} else if err != nil {
+		r.logger.Error(err, "Failed to get Service.", "Service.Name", svc.Name)
+		return err
+	}
+	return nil
+}
+
+// runs a query over the HTTP interface of ClickHouse with snuba's
+// credentials; returns whether it answered
+func (r *ReconcileSentry) checkClickHouse() (bool, error) {
+	status := &r.sentry.Status
+	c := r.sentry.Spec.Snuba.ClickHouse
+
+	password := ""
+	if sel := c.PasswordSecret; sel != nil {
+		value, err := r.readSecretKey(sel)
+		if err != nil {
+			status.SetCondition(v1alpha1.ConditionClickHouseReady, corev1.ConditionFalse, "MissingCredentials", err.Error())
+			return false, nil
+		}
+		password = value
+	}
+
+	address := net.JoinHostPort(clickHouseHost(&c), strconv.Itoa(c.HTTPPort))
+	query := url.Values{"query": {"SELECT 1"}, "database": {c.Database}}
+	req, err := http.NewRequest("GET", "http://"+address+"/?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-ClickHouse-User", c.User)
+	req.Header.Set("X-ClickHouse-Key", password)
+	client := &http.Client{Timeout: dialTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		r.logger.Info("ClickHouse check failed.", "Reason", "Unreachable", "Error", err.Error())
+		status.SetCondition(v1alpha1.ConditionClickHouseReady, corev1.ConditionFalse, "Unreachable", err.Error())
+		return false, nil
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		message := fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+		r.logger.Info("ClickHouse check failed.", "Reason", "QueryFailed", "Error", message)
+		status.SetCondition(v1alpha1.ConditionClickHouseReady, corev1.ConditionFalse, "QueryFailed", message)
+		return false, nil
+	}
+	status.SetCondition(v1alpha1.ConditionClickHouseReady, corev1.ConditionTrue, "Ready", fmt.Sprintf("connected to database '%s' on %s", c.Database, address))
+	return true, nil
+}
@@ -1,8 +1,13 @@
 package sentry
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"net"
+	"strings"
 
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -14,27 +19,174 @@ type templateOpts struct {
 	RestartPolicy  *corev1.RestartPolicy
 	ContainerPorts []corev1.ContainerPort
 	LivenessProbe  *corev1.Probe
+	Resources      corev1.ResourceRequirements
+}
+
+const (
+	postgresCertsPath = "/etc/sentry-operator/postgres"
+	hashAnnotation    = "sentry.redhat.com/hash"
+)
+
+// returns a short stable hash of v, used to notice when settings change
+func hashOf(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+// returns an environment variable read from the selected secret key
+func secretEnv(name string, sel *corev1.SecretKeySelector) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: sel,
+		},
+	}
+}
+
+// returns the database username, either literal or read from a secret
+func postgresUserEnv(name string, spec *v1alpha1.SentrySpec) corev1.EnvVar {
+	if sel := spec.PostgresUserSecret; sel != nil {
+		return secretEnv(name, sel)
+	}
+	return corev1.EnvVar{
+		Name:  name,
+		Value: spec.PostgresUser,
+	}
+}
+
+// returns a volume exposing the CA bundle pointed at by src as ca.crt
+func certificateVolume(name string, src *v1alpha1.CertificateSource) corev1.Volume {
+	items := []corev1.KeyToPath{{Key: src.Key, Path: "ca.crt"}}
+	if src.ConfigMapName != "" {
+		return corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: src.ConfigMapName,
+					},
+					Items: items,
+				},
+			},
+		}
+	}
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: src.SecretName,
+				Items:      items,
+			},
+		},
+	}
+}
+
+// returns the volumes, mounts and libpq environment needed to honour the
+// postgres TLS settings
+func postgresTLS(spec *v1alpha1.SentrySpec) ([]corev1.Volume, []corev1.VolumeMount, []corev1.EnvVar) {
+	volumes := []corev1.Volume{}
+	mounts := []corev1.VolumeMount{}
+	env := []corev1.EnvVar{
+		{
+			Name:  "PGSSLMODE",
+			Value: spec.PostgresSSLMode,
+		},
+	}
+
+	if ca := spec.PostgresSSLRootCert; ca != nil {
+		volumes = append(volumes, certificateVolume("postgres-ca", ca))
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "postgres-ca",
+			MountPath: postgresCertsPath + "/ca",
+			ReadOnly:  true,
+		})
+		env = append(env, corev1.EnvVar{
+			Name:  "PGSSLROOTCERT",
+			Value: postgresCertsPath + "/ca/ca.crt",
+		})
+	}
+
+	if secretName := spec.PostgresSSLClientSecret; secretName != "" {
+		// libpq refuses to load a private key readable by group or others
+		mode := int32(0600)
+		volumes = append(volumes, corev1.Volume{
+			Name: "postgres-client-cert",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  secretName,
+					DefaultMode: &mode,
+					Items: []corev1.KeyToPath{
+						{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+						{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+					},
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "postgres-client-cert",
+			MountPath: postgresCertsPath + "/client",
+			ReadOnly:  true,
+		})
+		env = append(env, corev1.EnvVar{
+			Name:  "PGSSLCERT",
+			Value: postgresCertsPath + "/client/" + corev1.TLSCertKey,
+		}, corev1.EnvVar{
+			Name:  "PGSSLKEY",
+			Value: postgresCertsPath + "/client/" + corev1.TLSPrivateKeyKey,
+		})
+	}
+
+	return volumes, mounts, env
+}
+
+// PostgresClient returns the volumes, mounts and libpq environment letting
+// postgres client tools such as pg_dump reach the database of a Sentry
+// instance, its defaults have to be set
+func PostgresClient(s *v1alpha1.Sentry) ([]corev1.Volume, []corev1.VolumeMount, []corev1.EnvVar) {
+	volumes, mounts, env := postgresTLS(&s.Spec)
+	env = append([]corev1.EnvVar{
+		{
+			Name:  "PGHOST",
+			Value: s.Spec.PostgresHost,
+		},
+		{
+			Name:  "PGPORT",
+			Value: fmt.Sprintf("%d", s.Spec.PostgresPort),
+		},
+		{
+			Name:  "PGDATABASE",
+			Value: s.Spec.PostgresDB,
+		},
+		postgresUserEnv("PGUSER", &s.Spec),
+		secretEnv("PGPASSWORD", s.Spec.PostgresPasswordSecret),
+	}, env...)
+	return volumes, mounts, env
+}
+
+// returns the redis host and port handed to the pods, with sentinel it's the
+// master last seen so that a failover rolls them out again
+func (r *ReconcileSentry) redisHostPort() (string, string) {
+	spec := r.sentry.Spec
+	if spec.RedisSentinel != nil {
+		host, port, err := net.SplitHostPort(r.sentry.Status.RedisMaster)
+		if err != nil {
+			return "", ""
+		}
+		return host, port
+	}
+	return spec.RedisHost, fmt.Sprintf("%d", spec.RedisPort)
 }
 
 // returns a common pod template for the various jobs/deployments
 func (r *ReconcileSentry) getCommonPodTemplate(opts templateOpts) corev1.PodTemplateSpec {
 	labels := map[string]string{"app": opts.Name}
+	redisHost, redisPort := r.redisHostPort()
 	env := []corev1.EnvVar{
 		{
 			Name:  "SENTRY_ENVIRONMENT",
 			Value: r.sentry.Spec.SentryEnvironment,
 		},
-		{
-			Name: "SENTRY_SECRET_KEY",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &corev1.SecretKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: r.sentry.Spec.SentrySecret,
-					},
-					Key: r.sentry.Spec.SentrySecretKeyKey,
-				},
-			},
-		},
+		secretEnv("SENTRY_SECRET_KEY", r.sentry.Spec.SentrySecretKeySecret),
 		{
 			Name:  "SENTRY_POSTGRES_HOST",
 			Value: r.sentry.Spec.PostgresHost,
@@ -47,28 +199,15 @@ func (r *ReconcileSentry) getCommonPodTemplate(opts templateOpts) corev1.PodTemp
 			Name:  "SENTRY_DB_NAME",
 			Value: r.sentry.Spec.PostgresDB,
 		},
-		{
-			Name:  "SENTRY_DB_USER",
-			Value: r.sentry.Spec.PostgresUser,
-		},
-		{
-			Name: "SENTRY_DB_PASSWORD",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &corev1.SecretKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: r.sentry.Spec.SentrySecret,
-					},
-					Key: r.sentry.Spec.PostgresPasswordKey,
-				},
-			},
-		},
+		postgresUserEnv("SENTRY_DB_USER", &r.sentry.Spec),
+		secretEnv("SENTRY_DB_PASSWORD", r.sentry.Spec.PostgresPasswordSecret),
 		{
 			Name:  "SENTRY_REDIS_HOST",
-			Value: r.sentry.Spec.RedisHost,
+			Value: redisHost,
 		},
 		{
 			Name:  "SENTRY_REDIS_PORT",
-			Value: fmt.Sprintf("%d", r.sentry.Spec.RedisPort),
+			Value: redisPort,
 		},
 		{
 			Name:  "SENTRY_REDIS_DB",
@@ -79,6 +218,105 @@ func (r *ReconcileSentry) getCommonPodTemplate(opts templateOpts) corev1.PodTemp
 			Value: "true",
 		},
 	}
+	if r.sentry.Spec.Memcached != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  "SENTRY_MEMCACHED_SERVERS",
+			Value: strings.Join(r.memcachedServers(), ","),
+		})
+	}
+	if r.sentry.Spec.Snuba != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  "SNUBA",
+			Value: snubaURL(),
+		})
+	}
+	if r.generatedSecretKey() {
+		optional := true
+		env = append(env, secretEnv("SENTRY_SECRET_KEY_PREVIOUS", &corev1.SecretKeySelector{
+			LocalObjectReference: r.sentry.Spec.SentrySecretKeySecret.LocalObjectReference,
+			Key:                  previousSecretKeyKey,
+			Optional:             &optional,
+		}))
+	}
+	if sel := r.sentry.Spec.RedisPasswordSecret; sel != nil {
+		env = append(env, secretEnv("SENTRY_REDIS_PASSWORD", sel))
+	}
+	if m := r.sentry.Spec.Mail; m != nil && m.PasswordSecret != nil {
+		env = append(env, secretEnv("SENTRY_EMAIL_PASSWORD", m.PasswordSecret))
+	}
+	if f := r.sentry.Spec.Filestore; f != nil && f.S3 != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  "SENTRY_FILESTORE_ENDPOINT",
+			Value: f.S3.Endpoint,
+		}, corev1.EnvVar{
+			Name:  "SENTRY_FILESTORE_BUCKET",
+			Value: f.S3.Bucket,
+		},
+			secretEnv("SENTRY_FILESTORE_ACCESS_KEY", f.S3.AccessKeyIDSelector()),
+			secretEnv("SENTRY_FILESTORE_SECRET_KEY", f.S3.SecretAccessKeySelector()),
+		)
+	}
+	if r.sentry.Spec.Relay != nil {
+		// the relay secret is only created once the migrations ran, the
+		// jobs before them don't need it
+		optional := true
+		env = append(env, secretEnv("SENTRY_RELAY_PUBLIC_KEY", &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: relayName},
+			Key:                  relayPublicKeyKey,
+			Optional:             &optional,
+		}))
+	}
+	volumes, mounts, pgEnv := postgresTLS(&r.sentry.Spec)
+	env = append(env, pgEnv...)
+	volumes = append(volumes, corev1.Volume{
+		Name: "sentry-config",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: configMapName,
+				},
+			},
+		},
+	})
+	mounts = append(mounts, corev1.VolumeMount{
+		Name:      "sentry-config",
+		MountPath: sentryConfPyPath,
+		SubPath:   sentryConfPyKey,
+		ReadOnly:  true,
+	}, corev1.VolumeMount{
+		Name:      "sentry-config",
+		MountPath: configYAMLPath,
+		SubPath:   configYAMLKey,
+		ReadOnly:  true,
+	})
+	if f := r.sentry.Spec.Filestore; f != nil && f.PersistentVolumeClaim != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "filestore",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: f.PersistentVolumeClaim,
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "filestore",
+			MountPath: filestorePath,
+		})
+	}
+	if k := r.sentry.Spec.Kafka; k != nil {
+		kafkaVolumes, kafkaMounts, kafkaEnv := kafkaClient(k)
+		volumes = append(volumes, kafkaVolumes...)
+		mounts = append(mounts, kafkaMounts...)
+		env = append(env, kafkaEnv...)
+	}
+	if ca := r.sentry.Spec.RedisSSLRootCert; ca != nil && r.sentry.Spec.RedisTLS {
+		volumes = append(volumes, certificateVolume("redis-ca", ca))
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "redis-ca",
+			MountPath: redisCertsPath + "/ca",
+			ReadOnly:  true,
+		})
+	}
 	if len(opts.ExtraEnv) > 0 {
 		env = append(env, opts.ExtraEnv...)
 	}
@@ -86,20 +324,32 @@ func (r *ReconcileSentry) getCommonPodTemplate(opts templateOpts) corev1.PodTemp
 	if opts.RestartPolicy != nil {
 		restartPolicy = *opts.RestartPolicy
 	}
+	annotations := map[string]string{
+		configHashAnnotation: r.configHash,
+	}
+	if rotation := r.secretKeyRotationFor(opts.Name); rotation != "" {
+		annotations[secretKeyAnnotation] = rotation
+	}
 	podTemplate := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: labels,
+			// files mounted with a subPath aren't updated in place, the
+			// pods are rolled instead
+			Annotations: annotations,
 		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{{
-				Image:           r.sentry.Spec.SentryImage,
+				Image:           r.runningImage(),
 				Name:            opts.Name,
 				Args:            opts.Args,
 				Env:             env,
 				ImagePullPolicy: corev1.PullAlways,
 				Ports:           opts.ContainerPorts,
 				LivenessProbe:   opts.LivenessProbe,
+				Resources:       opts.Resources,
+				VolumeMounts:    mounts,
 			}},
+			Volumes:       volumes,
 			RestartPolicy: restartPolicy,
 		},
 	}
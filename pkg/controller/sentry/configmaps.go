@@ -0,0 +1,478 @@
+package sentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	configMapName        = "sentry-config"
+	redisCertsPath       = "/etc/sentry-operator/redis"
+	sentryConfPyKey      = "sentry.conf.py"
+	sentryConfPyPath     = "/etc/sentry/sentry.conf.py"
+	configYAMLKey        = "config.yml"
+	configYAMLPath       = "/etc/sentry/config.yml"
+	configHashAnnotation = "sentry.redhat.com/config-hash"
+	filestorePath        = "/var/lib/sentry/files"
+	snubaSettingsKey     = "snuba_settings.py"
+	snubaSettingsPath    = "/etc/snuba/settings.py"
+)
+
+const generatedHeader = "# This file is generated by the sentry-operator, any change will be overwritten.\n"
+
+// sentry.conf.py replacing the one shipped in the sentry image, anything
+// secret is still passed through the environment
+var sentryConfPyTemplate = template.Must(template.New(sentryConfPyKey).Parse(generatedHeader + `from sentry.conf.server import *  # NOQA
+
+import os.path
+
+from six.moves.urllib.parse import quote
+
+CONF_ROOT = os.path.dirname(__file__)
+
+DATABASES = {
+    'default': {
+        'ENGINE': 'sentry.db.postgres',
+        'NAME': env('SENTRY_DB_NAME'),
+        'USER': env('SENTRY_DB_USER'),
+        'PASSWORD': env('SENTRY_DB_PASSWORD'),
+        'HOST': env('SENTRY_POSTGRES_HOST'),
+        'PORT': env('SENTRY_POSTGRES_PORT'),
+        'AUTOCOMMIT': True,
+        'ATOMIC_REQUESTS': False,
+    }
+}
+
+SENTRY_USE_BIG_INTS = True
+
+SENTRY_SINGLE_ORGANIZATION = {{ if .SingleOrganization }}True{{ else }}False{{ end }}
+{{- if .Features }}
+
+SENTRY_FEATURES.update({
+{{- range $name, $enabled := .Features }}
+    '{{ $name }}': {{ if $enabled }}True{{ else }}False{{ end }},
+{{- end }}
+})
+{{- end }}
+
+#########
+# Redis #
+#########
+
+redis_password = env('SENTRY_REDIS_PASSWORD')
+redis_db = env('SENTRY_REDIS_DB') or '0'
+{{- if .Sentinel }}
+
+# the master is looked up once when the process starts, the operator rolls the
+# pods out again after a failover and hands them the master it last saw in
+# case sentinel can't be reached
+from redis.sentinel import Sentinel, MasterNotFoundError
+try:
+    redis, redis_port = Sentinel(
+        [{{ .Sentinel }}],
+        socket_timeout=5,
+    ).discover_master({{ printf "%q" .SentinelMaster }})
+except MasterNotFoundError:
+    redis = env('SENTRY_REDIS_HOST')
+    redis_port = env('SENTRY_REDIS_PORT') or '6379'
+{{- else }}
+redis = env('SENTRY_REDIS_HOST')
+redis_port = env('SENTRY_REDIS_PORT') or '6379'
+{{- end }}
+
+redis_options = {
+    'host': redis,
+    'port': redis_port,
+    'password': redis_password,
+    'db': redis_db,
+}
+{{- if .RedisTLS }}
+redis_options['ssl'] = True
+redis_options['ssl_options'] = {
+    'cert_reqs': 'required',
+{{- if .RedisCA }}
+    'ca_certs': '{{ .RedisCA }}',
+{{- end }}
+}
+{{- end }}
+
+SENTRY_OPTIONS['redis.clusters'] = {
+    'default': {
+        'hosts': {
+            0: redis_options,
+        },
+    },
+}
+
+#########
+# Cache #
+#########
+
+memcached = env('SENTRY_MEMCACHED_SERVERS')
+if memcached:
+    CACHES = {
+        'default': {
+            'BACKEND': 'django.core.cache.backends.memcached.MemcachedCache',
+            'LOCATION': memcached.split(','),
+            'TIMEOUT': 3600,
+        }
+    }
+
+SENTRY_CACHE = 'sentry.cache.redis.RedisCache'
+
+#########
+# Queue #
+#########
+
+BROKER_URL = '{{ if .RedisTLS }}rediss{{ else }}redis{{ end }}://:%s@%s:%s/%s' % (quote(redis_password, safe=''), redis, redis_port, redis_db)
+{{- if .RedisTLS }}
+
+import ssl
+BROKER_USE_SSL = {
+    'ssl_cert_reqs': ssl.CERT_REQUIRED,
+{{- if .RedisCA }}
+    'ssl_ca_certs': '{{ .RedisCA }}',
+{{- end }}
+}
+{{- end }}
+
+###############
+# Rate Limits #
+###############
+
+SENTRY_RATELIMITER = 'sentry.ratelimits.redis.RedisRateLimiter'
+
+##################
+# Update Buffers #
+##################
+
+SENTRY_BUFFER = 'sentry.buffer.redis.RedisBuffer'
+
+##########
+# Quotas #
+##########
+
+SENTRY_QUOTAS = 'sentry.quotas.redis.RedisQuota'
+
+########
+# TSDB #
+########
+
+SENTRY_TSDB = 'sentry.tsdb.redis.RedisTSDB'
+
+###########
+# Digests #
+###########
+
+SENTRY_DIGESTS = 'sentry.digests.backends.redis.RedisBackend'
+
+{{- if .Kafka }}
+
+#########
+# Kafka #
+#########
+
+kafka_options = {
+    'bootstrap.servers': env('KAFKA_BOOTSTRAP_SERVERS'),
+    'security.protocol': env('KAFKA_SECURITY_PROTOCOL'),
+    'message.max.bytes': 50000000,
+    'socket.timeout.ms': 1000,
+}
+if env('KAFKA_SSL_CA_LOCATION'):
+    kafka_options['ssl.ca.location'] = env('KAFKA_SSL_CA_LOCATION')
+if env('KAFKA_SASL_MECHANISM'):
+    kafka_options['sasl.mechanism'] = env('KAFKA_SASL_MECHANISM')
+    kafka_options['sasl.username'] = env('KAFKA_SASL_USERNAME')
+    kafka_options['sasl.password'] = env('KAFKA_SASL_PASSWORD')
+
+KAFKA_CLUSTERS = {
+    'default': kafka_options,
+}
+{{- end }}
+{{- if .Snuba }}
+
+#########
+# Snuba #
+#########
+
+# the snuba api is read from the SNUBA environment variable
+SENTRY_SEARCH = 'sentry.search.snuba.EventsDatasetSnubaSearchBackend'
+SENTRY_SEARCH_OPTIONS = {}
+SENTRY_TAGSTORE_OPTIONS = {}
+SENTRY_TSDB = 'sentry.tsdb.redissnuba.RedisSnubaTSDB'
+SENTRY_EVENTSTREAM = 'sentry.eventstream.kafka.KafkaEventStream'
+{{- end }}
+{{- if .Relay }}
+
+#########
+# Relay #
+#########
+
+# events are ingested by relay, only trust the one registered by the operator
+SENTRY_USE_RELAY = True
+relay_public_key = env('SENTRY_RELAY_PUBLIC_KEY')
+SENTRY_RELAY_WHITELIST_PK = [relay_public_key] if relay_public_key else []
+{{- end }}
+{{- if .SymbolSources }}
+
+#################
+# Symbolication #
+#################
+
+# the symbolicator url is set in config.yml, the external symbol servers are
+# offered next to the ones sentry ships with
+SENTRY_BUILTIN_SOURCES = dict(SENTRY_BUILTIN_SOURCES)
+SENTRY_BUILTIN_SOURCES.update({
+{{- range .SymbolSources }}
+    {{ printf "%q" .ID }}: {
+        'type': 'http',
+        'id': {{ printf "%q" (print "sentry:" .ID) }},
+        'name': {{ printf "%q" .Name }},
+        'layout': {'type': {{ printf "%q" .Layout }}},
+        'url': {{ printf "%q" .URL }},
+        'is_public': True,
+    },
+{{- end }}
+})
+SENTRY_DEFAULT_BUILTIN_SOURCES = list(SENTRY_DEFAULT_BUILTIN_SOURCES) + [
+{{- range .SymbolSources }}
+    {{ printf "%q" .ID }},
+{{- end }}
+]
+{{- end }}
+
+##############
+# Web Server #
+##############
+
+SENTRY_WEB_HOST = env('SENTRY_WEB_HOST') or '0.0.0.0'
+SENTRY_WEB_PORT = int(env('SENTRY_WEB_PORT') or 9000)
+SENTRY_WEB_OPTIONS = {}
+
+##############
+# File store #
+##############
+
+# the filesystem store is configured in config.yml, options set in both files
+# are taken from config.yml so the bucket is only set up here
+filestore_bucket = env('SENTRY_FILESTORE_BUCKET')
+if filestore_bucket:
+    SENTRY_OPTIONS['filestore.backend'] = 's3'
+    SENTRY_OPTIONS['filestore.options'] = {
+        'access_key': env('SENTRY_FILESTORE_ACCESS_KEY'),
+        'secret_key': env('SENTRY_FILESTORE_SECRET_KEY'),
+        'bucket_name': filestore_bucket,
+        'endpoint_url': env('SENTRY_FILESTORE_ENDPOINT'),
+    }
+
+########
+# Mail #
+########
+
+# the rest of the mail options are in config.yml
+mail_password = env('SENTRY_EMAIL_PASSWORD')
+if mail_password:
+    SENTRY_OPTIONS['mail.password'] = mail_password
+
+##########
+# System #
+##########
+
+SENTRY_OPTIONS['system.secret-key'] = env('SENTRY_SECRET_KEY')
+
+# keeps what was signed before the last rotation valid, only Django 4.1 and
+# later look at it
+previous_secret_key = env('SENTRY_SECRET_KEY_PREVIOUS')
+if previous_secret_key:
+    SECRET_KEY_FALLBACKS = [previous_secret_key]
+{{- if .Override }}
+
+############
+# Override #
+############
+
+{{ .Override }}
+{{- end }}
+`))
+
+// snuba settings adding the kafka security settings to the docker ones,
+// which only know about the brokers
+const snubaSettingsPy = generatedHeader + `from snuba.settings.docker import *  # NOQA
+
+import os
+
+env = os.environ.get
+
+BROKER_CONFIG = {
+    'bootstrap.servers': env('KAFKA_BOOTSTRAP_SERVERS'),
+    'security.protocol': env('KAFKA_SECURITY_PROTOCOL'),
+}
+if env('KAFKA_SSL_CA_LOCATION'):
+    BROKER_CONFIG['ssl.ca.location'] = env('KAFKA_SSL_CA_LOCATION')
+if env('KAFKA_SASL_MECHANISM'):
+    BROKER_CONFIG['sasl.mechanism'] = env('KAFKA_SASL_MECHANISM')
+    BROKER_CONFIG['sasl.username'] = env('KAFKA_SASL_USERNAME')
+    BROKER_CONFIG['sasl.password'] = env('KAFKA_SASL_PASSWORD')
+`
+
+// values used to render sentry.conf.py
+type sentryConfPyValues struct {
+	Sentinel           string
+	SentinelMaster     string
+	RedisTLS           bool
+	RedisCA            string
+	SingleOrganization bool
+	Kafka              bool
+	Snuba              bool
+	Relay              bool
+	SymbolSources      []v1alpha1.SymbolSourceSpec
+	Features           map[string]bool
+	Override           string
+}
+
+// renders the sentry.conf.py for the current spec
+func (r *ReconcileSentry) renderSentryConfPy() (string, error) {
+	spec := r.sentry.Spec
+	values := sentryConfPyValues{
+		RedisTLS:           spec.RedisTLS,
+		SingleOrganization: *spec.Config.SingleOrganization,
+		Kafka:              spec.Kafka != nil,
+		Snuba:              spec.Snuba != nil,
+		Relay:              spec.Relay != nil,
+		Features:           spec.Config.Features,
+		Override:           strings.TrimSpace(spec.Config.SentryConfPy),
+	}
+	if sy := spec.Symbolicator; sy != nil {
+		values.SymbolSources = sy.Sources
+	}
+	if s := spec.RedisSentinel; s != nil {
+		sentinels := []string{}
+		for _, address := range s.Addresses {
+			// validateSpec rejected the addresses that don't split
+			host, port, _ := sentinelHostPort(address)
+			sentinels = append(sentinels, fmt.Sprintf("(%q, %d)", host, port))
+		}
+		values.Sentinel = strings.Join(sentinels, ", ")
+		values.SentinelMaster = s.MasterName
+	}
+	if spec.RedisTLS && spec.RedisSSLRootCert != nil {
+		values.RedisCA = redisCertsPath + "/ca/ca.crt"
+	}
+
+	var buf bytes.Buffer
+	if err := sentryConfPyTemplate.Execute(&buf, values); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// returns the sentry options written to config.yml
+func (r *ReconcileSentry) sentryOptions() map[string]interface{} {
+	config := r.sentry.Spec.Config
+	options := map[string]interface{}{
+		"mail.backend": "dummy",
+	}
+	if f := r.sentry.Spec.Filestore; f == nil || f.S3 == nil {
+		options["filestore.backend"] = "filesystem"
+		options["filestore.options"] = map[string]string{
+			"location": filestorePath,
+		}
+	}
+	if m := r.sentry.Spec.Mail; m != nil {
+		options["mail.backend"] = "smtp"
+		options["mail.host"] = m.Host
+		options["mail.port"] = m.Port
+		options["mail.username"] = m.Username
+		options["mail.use-tls"] = m.UseTLS
+		options["mail.use-ssl"] = m.UseSSL
+		options["mail.from"] = m.From
+		options["mail.list-namespace"] = m.ListNamespace
+	}
+	if r.sentry.Spec.Symbolicator != nil {
+		options["symbolicator.enabled"] = true
+		options["symbolicator.options"] = map[string]string{
+			"url": symbolicatorURL(),
+		}
+	}
+	if config.URLPrefix != "" {
+		options["system.url-prefix"] = config.URLPrefix
+	}
+	if config.AdminEmail != "" {
+		options["system.admin-email"] = config.AdminEmail
+	}
+	for key, value := range config.Options {
+		options[key] = value
+	}
+	return options
+}
+
+// renders the config.yml for the current spec, values are written as JSON
+// which YAML reads just the same
+func (r *ReconcileSentry) renderConfigYAML() (string, error) {
+	options := r.sentryOptions()
+	keys := []string{}
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString(generatedHeader)
+	for _, key := range keys {
+		value, err := json.Marshal(options[key])
+		if err != nil {
+			return "", err
+		}
+		name, _ := json.Marshal(key)
+		fmt.Fprintf(&buf, "%s: %s\n", name, value)
+	}
+	if override := strings.TrimSpace(r.sentry.Spec.Config.ConfigYAML); override != "" {
+		buf.WriteString("\n# Override\n")
+		buf.WriteString(override + "\n")
+	}
+	return buf.String(), nil
+}
+
+// configmap holding the generated sentry configuration
+func (r *ReconcileSentry) configMapForSentry() (*corev1.ConfigMap, error) {
+	confPy, err := r.renderSentryConfPy()
+	if err != nil {
+		return nil, err
+	}
+	configYAML, err := r.renderConfigYAML()
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{
+		sentryConfPyKey: confPy,
+		configYAMLKey:   configYAML,
+	}
+	if r.sentry.Spec.Snuba != nil {
+		data[snubaSettingsKey] = snubaSettingsPy
+	}
+	if r.sentry.Spec.Symbolicator != nil {
+		data[symbolicatorConfigKey] = symbolicatorConfig
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:    map[string]string{"app": "sentry"},
+			Name:      configMapName,
+			Namespace: r.sentry.Namespace,
+		},
+		Data: data,
+	}
+
+	controllerutil.SetControllerReference(r.sentry, cm, r.scheme)
+	return cm, nil
+}
@@ -0,0 +1,313 @@
+package sentry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// returns a reconciler holding a defaulted instance with the given spec
+func reconcilerFor(spec v1alpha1.SentrySpec) *ReconcileSentry {
+	instance := &v1alpha1.Sentry{
+		ObjectMeta: metav1.ObjectMeta{Name: "sentry", Namespace: "sentry"},
+		Spec:       spec,
+	}
+	instance.SetDefaults()
+	return &ReconcileSentry{sentry: instance}
+}
+
+// checks that rendered holds every string of want and none of unwanted
+func checkRendered(t *testing.T, rendered string, want, unwanted []string) {
+	for _, s := range want {
+		if !strings.Contains(rendered, s) {
+			t.Errorf("rendered configuration is missing %q:\n%s", s, rendered)
+		}
+	}
+	for _, s := range unwanted {
+		if strings.Contains(rendered, s) {
+			t.Errorf("rendered configuration holds %q:\n%s", s, rendered)
+		}
+	}
+}
+
+func TestRenderSentryConfPy(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     v1alpha1.SentrySpec
+		want     []string
+		unwanted []string
+	}{
+		{
+			name: "redis host",
+			spec: v1alpha1.SentrySpec{RedisHost: "redis"},
+			want: []string{
+				generatedHeader,
+				"redis = env('SENTRY_REDIS_HOST')",
+				"BROKER_URL = 'redis://",
+				"SENTRY_SINGLE_ORGANIZATION = True",
+			},
+			unwanted: []string{"Sentinel", "redis_options['ssl']", "# Override"},
+		},
+		{
+			name: "sentinel",
+			spec: v1alpha1.SentrySpec{
+				RedisSentinel: &v1alpha1.RedisSentinelSpec{
+					Addresses:  []string{"sentinel-0.sentinel:26380", "10.0.0.2", "[fd00::1]:26379"},
+					MasterName: "it's-master",
+				},
+			},
+			want: []string{
+				"from redis.sentinel import Sentinel",
+				`[("sentinel-0.sentinel", 26380), ("10.0.0.2", 26379), ("fd00::1", 26379)],`,
+				`.discover_master("it's-master")`,
+				// the master the operator last saw
+				"except MasterNotFoundError:\n    redis = env('SENTRY_REDIS_HOST')",
+			},
+		},
+		{
+			name: "redis tls",
+			spec: v1alpha1.SentrySpec{
+				RedisHost:        "redis",
+				RedisTLS:         true,
+				RedisSSLRootCert: &v1alpha1.CertificateSource{SecretName: "redis-ca"},
+			},
+			want: []string{
+				"redis_options['ssl'] = True",
+				"'ca_certs': '" + redisCertsPath + "/ca/ca.crt',",
+				"BROKER_URL = 'rediss://",
+			},
+		},
+		{
+			name: "memcached",
+			spec: v1alpha1.SentrySpec{RedisHost: "redis", Memcached: &v1alpha1.MemcachedSpec{Replicas: 3}},
+			want: []string{
+				"memcached = env('SENTRY_MEMCACHED_SERVERS')",
+				"'LOCATION': memcached.split(','),",
+			},
+		},
+		{
+			name: "s3 filestore",
+			spec: v1alpha1.SentrySpec{
+				RedisHost: "redis",
+				Filestore: &v1alpha1.FilestoreSpec{S3: &v1alpha1.S3Storage{Bucket: "files", CredentialsSecret: "s3"}},
+			},
+			want: []string{
+				"filestore_bucket = env('SENTRY_FILESTORE_BUCKET')",
+				"SENTRY_OPTIONS['filestore.backend'] = 's3'",
+				"'bucket_name': filestore_bucket,",
+				"'endpoint_url': env('SENTRY_FILESTORE_ENDPOINT'),",
+			},
+		},
+		{
+			name: "mail",
+			spec: v1alpha1.SentrySpec{
+				RedisHost: "redis",
+				Mail:      &v1alpha1.MailSpec{Host: "smtp.example.com", From: "sentry@example.com"},
+			},
+			want: []string{
+				"mail_password = env('SENTRY_EMAIL_PASSWORD')",
+				"SENTRY_OPTIONS['mail.password'] = mail_password",
+			},
+		},
+		{
+			name: "secret key fallbacks",
+			spec: v1alpha1.SentrySpec{RedisHost: "redis"},
+			want: []string{
+				"SENTRY_OPTIONS['system.secret-key'] = env('SENTRY_SECRET_KEY')",
+				"previous_secret_key = env('SENTRY_SECRET_KEY_PREVIOUS')",
+				"SECRET_KEY_FALLBACKS = [previous_secret_key]",
+			},
+		},
+		{
+			name: "features and override",
+			spec: v1alpha1.SentrySpec{
+				RedisHost: "redis",
+				Config: v1alpha1.SentryConfigSpec{
+					Features:     map[string]bool{"organizations:discover": true, "auth:register": false},
+					SentryConfPy: "\nSENTRY_BEACON = False\n",
+				},
+			},
+			want: []string{
+				"    'auth:register': False,\n    'organizations:discover': True,\n",
+				"# Override #\n############\n\nSENTRY_BEACON = False\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := reconcilerFor(tt.spec).renderSentryConfPy()
+			if err != nil {
+				t.Fatalf("renderSentryConfPy failed: %s", err)
+			}
+			checkRendered(t, rendered, tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestRenderConfigYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     v1alpha1.SentrySpec
+		want     []string
+		unwanted []string
+	}{
+		{
+			name: "defaults",
+			spec: v1alpha1.SentrySpec{RedisHost: "redis"},
+			want: []string{
+				generatedHeader + `"filestore.backend": "filesystem"` + "\n" +
+					`"filestore.options": {"location":"` + filestorePath + `"}` + "\n" +
+					`"mail.backend": "dummy"` + "\n",
+			},
+			unwanted: []string{`"mail.host"`, `"symbolicator.enabled"`, "# Override"},
+		},
+		{
+			name: "s3 filestore",
+			spec: v1alpha1.SentrySpec{
+				RedisHost: "redis",
+				Filestore: &v1alpha1.FilestoreSpec{S3: &v1alpha1.S3Storage{Bucket: "files", CredentialsSecret: "s3"}},
+			},
+			// set up by sentry.conf.py, config.yml would win over it
+			unwanted: []string{`"filestore.backend"`, `"filestore.options"`},
+		},
+		{
+			name: "mail",
+			spec: v1alpha1.SentrySpec{
+				RedisHost: "redis",
+				Mail: &v1alpha1.MailSpec{
+					Host:     "smtp.example.com",
+					Port:     587,
+					Username: "sentry",
+					UseTLS:   true,
+					From:     "sentry@example.com",
+				},
+			},
+			want: []string{
+				`"mail.backend": "smtp"`,
+				`"mail.from": "sentry@example.com"`,
+				`"mail.host": "smtp.example.com"`,
+				`"mail.port": 587`,
+				`"mail.use-ssl": false`,
+				`"mail.use-tls": true`,
+				`"mail.username": "sentry"`,
+			},
+			// the password comes from the environment
+			unwanted: []string{`"mail.backend": "dummy"`, `"mail.password"`},
+		},
+		{
+			name: "system options and overrides",
+			spec: v1alpha1.SentrySpec{
+				RedisHost: "redis",
+				Config: v1alpha1.SentryConfigSpec{
+					URLPrefix:  "https://sentry.example.com",
+					AdminEmail: "admin@example.com",
+					Options:    map[string]string{"mail.backend": "console", "beacon.anonymous": "true"},
+					ConfigYAML: "auth.allow-registration: false\n",
+				},
+			},
+			want: []string{
+				`"beacon.anonymous": "true"`,
+				`"mail.backend": "console"`,
+				`"system.admin-email": "admin@example.com"`,
+				`"system.url-prefix": "https://sentry.example.com"`,
+				"\n# Override\nauth.allow-registration: false\n",
+			},
+			unwanted: []string{`"mail.backend": "dummy"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := reconcilerFor(tt.spec).renderConfigYAML()
+			if err != nil {
+				t.Fatalf("renderConfigYAML failed: %s", err)
+			}
+			checkRendered(t, rendered, tt.want, tt.unwanted)
+		})
+	}
+}
+
+func TestMemcachedServers(t *testing.T) {
+	tests := []struct {
+		name      string
+		memcached v1alpha1.MemcachedSpec
+		want      []string
+	}{
+		{
+			name:      "managed",
+			memcached: v1alpha1.MemcachedSpec{},
+			want:      []string{"sentry-memcached-0.sentry-memcached:11211"},
+		},
+		{
+			name:      "managed replicas",
+			memcached: v1alpha1.MemcachedSpec{Replicas: 3, Port: 11212},
+			want: []string{
+				"sentry-memcached-0.sentry-memcached:11212",
+				"sentry-memcached-1.sentry-memcached:11212",
+				"sentry-memcached-2.sentry-memcached:11212",
+			},
+		},
+		{
+			name:      "external",
+			memcached: v1alpha1.MemcachedSpec{Host: "memcached.cache", Replicas: 3},
+			want:      []string{"memcached.cache:11211"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memcached := tt.memcached
+			r := reconcilerFor(v1alpha1.SentrySpec{RedisHost: "redis", Memcached: &memcached})
+			if got := r.memcachedServers(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("memcachedServers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisHostPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     v1alpha1.SentrySpec
+		master   string
+		wantHost string
+		wantPort string
+	}{
+		{
+			name:     "redis host",
+			spec:     v1alpha1.SentrySpec{RedisHost: "redis", RedisPort: 6380},
+			master:   "10.0.0.1:6379",
+			wantHost: "redis",
+			wantPort: "6380",
+		},
+		{
+			name:     "sentinel",
+			spec:     v1alpha1.SentrySpec{RedisSentinel: &v1alpha1.RedisSentinelSpec{Addresses: []string{"sentinel"}}},
+			master:   "10.0.0.1:6379",
+			wantHost: "10.0.0.1",
+			wantPort: "6379",
+		},
+		{
+			name:     "sentinel ipv6",
+			spec:     v1alpha1.SentrySpec{RedisSentinel: &v1alpha1.RedisSentinelSpec{Addresses: []string{"sentinel"}}},
+			master:   "[fd00::1]:6379",
+			wantHost: "fd00::1",
+			wantPort: "6379",
+		},
+		{
+			name:   "sentinel not asked yet",
+			spec:   v1alpha1.SentrySpec{RedisSentinel: &v1alpha1.RedisSentinelSpec{Addresses: []string{"sentinel"}}},
+			master: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := reconcilerFor(tt.spec)
+			r.sentry.Status.RedisMaster = tt.master
+			if host, port := r.redisHostPort(); host != tt.wantHost || port != tt.wantPort {
+				t.Errorf("redisHostPort() = %q, %q, want %q, %q", host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
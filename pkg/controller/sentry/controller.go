@@ -2,7 +2,12 @@ package sentry
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
 	"strings"
 	"time"
 
@@ -10,11 +15,14 @@ import (
 	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -26,6 +34,12 @@ import (
 
 var log = logf.Log.WithName("sentry")
 
+var featureName = regexp.MustCompile(`^[a-z0-9][a-z0-9:._-]*$`)
+
+var kafkaTopicName = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+var symbolSourceID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
 // Add creates a new Sentry Controller and adds it to the Manager. The Manager
 // will set fields on the Controller and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
@@ -34,7 +48,7 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileSentry{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return &ReconcileSentry{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetRecorder("sentry-controller")}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -61,6 +75,53 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch the deployments so stalled rollouts are reported
+	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &v1alpha1.Sentry{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch the jobs we're waiting on so their completion is noticed right away
+	err = c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &v1alpha1.Sentry{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch the secrets holding the superuser credentials, changing them
+	// updates the superuser
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: superUserSecretMapper(mgr.GetClient()),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch the cleanup cronjob, its status changes as its jobs come and go
+	err = c.Watch(&source.Kind{Type: &batchv1beta1.CronJob{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &v1alpha1.Sentry{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch the backups and restores guarding upgrades for the same reason
+	for _, t := range []runtime.Object{&v1alpha1.SentryBackup{}, &v1alpha1.SentryRestore{}} {
+		err = c.Watch(&source.Kind{Type: t}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &v1alpha1.Sentry{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -71,45 +132,372 @@ var _ reconcile.Reconciler = &ReconcileSentry{}
 type ReconcileSentry struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client  client.Client
-	scheme  *runtime.Scheme
-	logger  logr.Logger
-	secrets map[string]string
-	sentry  *v1alpha1.Sentry
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	logger   logr.Logger
+	secrets  map[string]string
+	sentry   *v1alpha1.Sentry
+	// hash of the generated configuration, changing it rolls the pods
+	configHash string
+	// rotations of the secret key processes stay on while others roll
+	secretKeyRollout map[string]string
+	// hash of the relay configuration and credentials
+	relayConfigHash string
 }
 
 func (r *ReconcileSentry) validateSecrets() error {
-	secretName := r.sentry.Spec.SentrySecret
+	spec := r.sentry.Spec
 	ns := r.sentry.ObjectMeta.Namespace
-	secret := &corev1.Secret{}
 
-	r.logger.Info(fmt.Sprintf("loading secrets from '%s'", secretName))
+	type credential struct {
+		name string
+		sel  *corev1.SecretKeySelector
+	}
+	credentials := []credential{
+		{"sentry secret key", spec.SentrySecretKeySecret},
+		{"database password", spec.PostgresPasswordSecret},
+		{"superuser email", spec.SentrySuperUserEmailSecret},
+		{"superuser password", spec.SentrySuperUserPasswordSecret},
+	}
+	if spec.PostgresUser == "" {
+		credentials = append(credentials, credential{"database user", spec.PostgresUserSecret})
+	}
+	if spec.RedisPasswordSecret != nil {
+		credentials = append(credentials, credential{"redis password", spec.RedisPasswordSecret})
+	}
+	if m := spec.Mail; m != nil && m.PasswordSecret != nil {
+		credentials = append(credentials, credential{"mail password", m.PasswordSecret})
+	}
+	if sn := spec.Snuba; sn != nil && sn.ClickHouse.PasswordSecret != nil {
+		credentials = append(credentials, credential{"clickhouse password", sn.ClickHouse.PasswordSecret})
+	}
+	if k := spec.Kafka; k != nil && k.SASL != nil && k.SASL.PasswordSecret != nil {
+		credentials = append(credentials, credential{"kafka sasl password", k.SASL.PasswordSecret})
+	}
+	if f := spec.Filestore; f != nil && f.S3 != nil {
+		credentials = append(credentials,
+			credential{"filestore access key id", f.S3.AccessKeyIDSelector()},
+			credential{"filestore secret access key", f.S3.SecretAccessKeySelector()},
+		)
+	}
+
+	// load and validate required secrets, fetching each secret only once
+	secrets := map[string]*corev1.Secret{}
+	problems := []string{}
+	for _, c := range credentials {
+		if c.sel == nil {
+			problems = append(problems, fmt.Sprintf("no secret provides the %s", c.name))
+			continue
+		}
+		secret, ok := secrets[c.sel.Name]
+		if !ok {
+			r.logger.Info(fmt.Sprintf("loading secrets from '%s'", c.sel.Name))
+			secret = &corev1.Secret{}
+			err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: ns, Name: c.sel.Name}, secret)
+			if err != nil {
+				if !errors.IsNotFound(err) {
+					return err
+				}
+				problems = append(problems, fmt.Sprintf("the secret '%s' was not found in namespace '%s'", c.sel.Name, ns))
+				secret = nil
+			}
+			secrets[c.sel.Name] = secret
+		}
+		if secret == nil {
+			continue
+		}
+		if _, ok := secret.Data[c.sel.Key]; !ok {
+			problems = append(problems, fmt.Sprintf("key '%s' holding the %s is missing from secret '%s'", c.sel.Key, c.name, c.sel.Name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("errors found when loading credentials: %s", strings.Join(problems, ", "))
+	}
+
+	return nil
+}
 
-	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: ns, Name: secretName}, secret)
+// checks the filestore claim can be mounted by every replica
+func (r *ReconcileSentry) validateFilestore() error {
+	f := r.sentry.Spec.Filestore
+	if f == nil || f.PersistentVolumeClaim == "" {
+		return nil
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: r.sentry.Namespace, Name: f.PersistentVolumeClaim}, pvc)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return fmt.Errorf("the provided secret '%s' was not found in namespace '%s'", secretName, ns)
+			return fmt.Errorf("the filestore claim '%s' was not found in namespace '%s'", f.PersistentVolumeClaim, r.sentry.Namespace)
 		}
 		return err
 	}
+	for _, mode := range pvc.Spec.AccessModes {
+		if mode == corev1.ReadWriteMany {
+			return nil
+		}
+	}
+	return fmt.Errorf("the filestore claim '%s' isn't ReadWriteMany, it can't be shared by the sentry pods", f.PersistentVolumeClaim)
+}
 
-	// load and validate required secrets
+// validates the parts of the spec the CRD schema can't express
+func (r *ReconcileSentry) validateSpec() error {
+	spec := r.sentry.Spec
 	errors := []string{}
-	required := []string{
-		r.sentry.Spec.SentrySecretKeyKey,
-		r.sentry.Spec.PostgresPasswordKey,
-		r.sentry.Spec.SentrySuperUserEmailKey,
-		r.sentry.Spec.SentrySuperUserPasswordKey,
+
+	switch spec.PostgresSSLMode {
+	case "disable", "allow", "prefer", "require":
+	case "verify-ca", "verify-full":
+		if spec.PostgresSSLRootCert == nil {
+			errors = append(errors, fmt.Sprintf("postgresSSLMode '%s' requires postgresSSLRootCert", spec.PostgresSSLMode))
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("unknown postgresSSLMode '%s'", spec.PostgresSSLMode))
+	}
+	if ca := spec.PostgresSSLRootCert; ca != nil && (ca.SecretName == "") == (ca.ConfigMapName == "") {
+		errors = append(errors, "postgresSSLRootCert needs exactly one of secretName or configMapName")
 	}
-	for _, secretKey := range required {
-		if _, ok := secret.Data[secretKey]; !ok {
-			errors = append(errors, fmt.Sprintf("key '%s' is missing", secretKey))
+
+	if s := spec.RedisSentinel; s != nil {
+		if len(s.Addresses) == 0 {
+			errors = append(errors, "redisSentinel needs at least one address")
+		}
+		for _, address := range s.Addresses {
+			if _, _, err := sentinelHostPort(address); err != nil {
+				errors = append(errors, fmt.Sprintf("invalid redisSentinel address '%s': %s", address, err))
+			}
 		}
+	} else if spec.RedisHost == "" {
+		errors = append(errors, "one of redisHost or redisSentinel is required")
 	}
-	if len(errors) > 0 {
-		return fmt.Errorf("errors found when loading values from secret '%s': %s", secretName, strings.Join(errors, ", "))
+	if ca := spec.RedisSSLRootCert; ca != nil {
+		if !spec.RedisTLS {
+			errors = append(errors, "redisSSLRootCert requires redisTLS")
+		}
+		if (ca.SecretName == "") == (ca.ConfigMapName == "") {
+			errors = append(errors, "redisSSLRootCert needs exactly one of secretName or configMapName")
+		}
+	}
+
+	if m := spec.Mail; m != nil {
+		if m.Host == "" {
+			errors = append(errors, "mail needs a host")
+		}
+		if m.Port < 1 || m.Port > 65535 {
+			errors = append(errors, fmt.Sprintf("mail port %d is out of range", m.Port))
+		}
+		if m.UseTLS && m.UseSSL {
+			errors = append(errors, "mail can't use both useTLS and useSSL")
+		}
+		if m.PasswordSecret != nil && m.Username == "" {
+			errors = append(errors, "mail passwordSecret requires a username")
+		}
+		if _, err := mail.ParseAddress(m.From); err != nil {
+			errors = append(errors, fmt.Sprintf("invalid mail from address '%s': %s", m.From, err))
+		}
+		if strings.ContainsAny(m.ListNamespace, " \t<>@") {
+			errors = append(errors, fmt.Sprintf("invalid mail listNamespace '%s'", m.ListNamespace))
+		}
+	}
+
+	for name := range spec.Config.Features {
+		if !featureName.MatchString(name) {
+			errors = append(errors, fmt.Sprintf("invalid feature name '%s'", name))
+		}
+	}
+	for key := range spec.Config.Options {
+		if key == "" {
+			errors = append(errors, "config options can't have an empty key")
+		}
+	}
+	if raw := spec.Config.ConfigYAML; raw != "" {
+		var options map[string]interface{}
+		data, err := yaml.ToJSON([]byte(raw))
+		if err == nil {
+			err = json.Unmarshal(data, &options)
+		}
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("config.configYAML isn't a YAML mapping: %s", err))
+		}
+	}
+
+	if k := spec.Kafka; k != nil {
+		if len(k.BootstrapServers) == 0 {
+			errors = append(errors, "kafka needs at least one bootstrap server")
+		}
+		switch k.SecurityProtocol {
+		case "PLAINTEXT", "SSL":
+			if k.SASL != nil {
+				errors = append(errors, fmt.Sprintf("kafka securityProtocol '%s' doesn't use sasl", k.SecurityProtocol))
+			}
+		case "SASL_PLAINTEXT", "SASL_SSL":
+			if k.SASL == nil {
+				errors = append(errors, fmt.Sprintf("kafka securityProtocol '%s' requires sasl", k.SecurityProtocol))
+			}
+		default:
+			errors = append(errors, fmt.Sprintf("unknown kafka securityProtocol '%s'", k.SecurityProtocol))
+		}
+		if ca := k.SSLRootCert; ca != nil {
+			if !strings.HasSuffix(k.SecurityProtocol, "SSL") {
+				errors = append(errors, "kafka sslRootCert requires the SSL or SASL_SSL securityProtocol")
+			}
+			if (ca.SecretName == "") == (ca.ConfigMapName == "") {
+				errors = append(errors, "kafka sslRootCert needs exactly one of secretName or configMapName")
+			}
+		}
+		if sasl := k.SASL; sasl != nil {
+			switch sasl.Mechanism {
+			case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+			default:
+				errors = append(errors, fmt.Sprintf("unknown kafka sasl mechanism '%s'", sasl.Mechanism))
+			}
+			if sasl.Username == "" || sasl.PasswordSecret == nil {
+				errors = append(errors, "kafka sasl needs a username and a passwordSecret")
+			}
+		}
+		if k.Topics.Partitions < 1 || k.Topics.ReplicationFactor < 1 {
+			errors = append(errors, "kafka topics partitions and replicationFactor must be at least 1")
+		}
+		for topic, n := range k.Topics.TopicPartitions {
+			if !kafkaTopicName.MatchString(topic) {
+				errors = append(errors, fmt.Sprintf("invalid kafka topic name '%s'", topic))
+			}
+			if n < 1 {
+				errors = append(errors, fmt.Sprintf("kafka topic '%s' needs at least 1 partition", topic))
+			}
+		}
+	}
+	if sn := spec.Snuba; sn != nil {
+		if spec.Kafka == nil {
+			errors = append(errors, "snuba requires kafka")
+		}
+		if c := sn.ClickHouse; c.Managed() {
+			if c.PasswordSecret != nil || c.User != "default" {
+				errors = append(errors, "snuba clickhouse user and passwordSecret only apply to an external host")
+			}
+			if _, err := resource.ParseQuantity(c.StorageSize); err != nil {
+				errors = append(errors, fmt.Sprintf("invalid snuba clickhouse storageSize '%s'", c.StorageSize))
+			}
+		}
+		if spec.RedisSentinel != nil || spec.RedisTLS {
+			errors = append(errors, "snuba can't reach redis through sentinel or over TLS, it needs redisHost")
+		}
+		if sn.APIReplicas < 1 || sn.ConsumerReplicas < 1 {
+			errors = append(errors, "snuba replicas must be at least 1")
+		}
+	}
+
+	if rl := spec.Relay; rl != nil {
+		if spec.Snuba == nil {
+			errors = append(errors, "relay requires snuba")
+		}
+		if rl.Replicas < 1 {
+			errors = append(errors, "relay replicas must be at least 1")
+		}
+	}
+	rollouts := spec.Rollouts
+	errors = append(errors, validateRollout("web", rollouts.Web)...)
+	errors = append(errors, validateRollout("worker", rollouts.Worker)...)
+	errors = append(errors, validateRollout("cron", rollouts.Cron)...)
+	errors = append(errors, validateRollout("consumers", rollouts.Consumers)...)
+	errors = append(errors, validateRollout("snuba", rollouts.Snuba)...)
+	errors = append(errors, validateRollout("relay", rollouts.Relay)...)
+	errors = append(errors, validateStatefulSetRollout("memcached", rollouts.Memcached)...)
+
+	if ing := spec.Ingress; ing != nil && ing.Host == "" {
+		errors = append(errors, "ingress needs a host")
+	}
+	if sy := spec.Symbolicator; sy != nil {
+		if sy.Replicas < 1 {
+			errors = append(errors, "symbolicator replicas must be at least 1")
+		}
+		if _, err := resource.ParseQuantity(sy.CacheSize); err != nil {
+			errors = append(errors, fmt.Sprintf("invalid symbolicator cacheSize '%s'", sy.CacheSize))
+		}
+		ids := map[string]bool{}
+		for _, src := range sy.Sources {
+			if !symbolSourceID.MatchString(src.ID) {
+				errors = append(errors, fmt.Sprintf("invalid symbol source id '%s'", src.ID))
+			}
+			if ids[src.ID] {
+				errors = append(errors, fmt.Sprintf("duplicate symbol source id '%s'", src.ID))
+			}
+			ids[src.ID] = true
+			if u, err := url.Parse(src.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errors = append(errors, fmt.Sprintf("invalid symbol source url '%s'", src.URL))
+			}
+			switch src.Layout {
+			case "native", "symstore", "symstore_index2", "ssqp", "unified":
+			default:
+				errors = append(errors, fmt.Sprintf("unknown symbol source layout '%s'", src.Layout))
+			}
+		}
+	}
+
+	if f := spec.Filestore; f != nil {
+		if (f.PersistentVolumeClaim == "") == (f.S3 == nil) {
+			errors = append(errors, "filestore needs exactly one of persistentVolumeClaim or s3")
+		}
+		if f.S3 != nil && f.S3.Bucket == "" {
+			errors = append(errors, "filestore s3 needs a bucket")
+		}
+		if f.S3 != nil && f.S3.CredentialsSecret == "" {
+			errors = append(errors, "filestore s3 needs a credentialsSecret")
+		}
+		if f.S3 != nil {
+			if u, err := url.Parse(f.S3.Endpoint); err != nil || u.Host == "" {
+				errors = append(errors, fmt.Sprintf("invalid filestore s3 endpoint '%s'", f.S3.Endpoint))
+			}
+		}
+	}
+
+	if rt := spec.Retention; rt != nil {
+		if rt.Days < 1 {
+			errors = append(errors, "retention days must be at least 1")
+		}
+		if rt.Concurrency < 1 {
+			errors = append(errors, "retention concurrency must be at least 1")
+		}
+		if fields := strings.Fields(rt.Schedule); len(fields) != 5 && !(len(fields) == 1 && strings.HasPrefix(fields[0], "@")) {
+			errors = append(errors, fmt.Sprintf("invalid retention schedule '%s'", rt.Schedule))
+		}
+		if *rt.SuccessfulJobsHistoryLimit < 0 || *rt.FailedJobsHistoryLimit < 0 {
+			errors = append(errors, "retention job history limits can't be negative")
+		}
+	}
+
+	switch spec.Upgrade.Strategy {
+	case v1alpha1.UpgradeInPlace, v1alpha1.UpgradeBlueGreen:
+	default:
+		errors = append(errors, fmt.Sprintf("unknown upgrade strategy '%s'", spec.Upgrade.Strategy))
+	}
+	if spec.Upgrade.PreviousSetRetentionSeconds < 0 {
+		errors = append(errors, "upgrade previousSetRetentionSeconds can't be negative")
+	}
+	if c := spec.Canary; c != nil {
+		if c.Image == "" {
+			errors = append(errors, "canary needs an image")
+		}
+		if c.Share < 1 || c.Share > 100 {
+			errors = append(errors, fmt.Sprintf("canary share %d isn't a percentage", c.Share))
+		}
+		if c.AnalysisSeconds < 0 || *c.MaxRestarts < 0 {
+			errors = append(errors, "canary analysisSeconds and maxRestarts can't be negative")
+		}
+	}
+
+	if ub := spec.UpgradeBackup; ub != nil {
+		if (ub.Storage.PersistentVolumeClaim == "") == (ub.Storage.S3 == nil) {
+			errors = append(errors, "upgradeBackup storage needs exactly one of persistentVolumeClaim or s3")
+		}
+		if ub.Retention < 0 {
+			errors = append(errors, "upgradeBackup retention can't be negative")
+		}
 	}
 
+	if len(errors) > 0 {
+		return fmt.Errorf("invalid spec: %s", strings.Join(errors, ", "))
+	}
 	return nil
 }
 
@@ -137,54 +525,184 @@ func (r *ReconcileSentry) Reconcile(request reconcile.Request) (reconcile.Result
 	}
 
 	r.sentry.SetDefaults()
+	r.secretKeyRollout = nil
+
+	// a paused instance is left alone once its processes are scaled down
+	if r.sentry.Paused() {
+		r.logger.Info("Sentry is paused.", "PausedBy", r.sentry.Annotations[v1alpha1.PausedAnnotation])
+		if err := r.scaleDown(); err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := r.suspendCleanup(); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, r.updateStatus("Paused")
+	}
+
+	if err := r.validateSpec(); err != nil {
+		return reconcile.Result{}, err
+	}
+	if err := r.generateSecrets(); err != nil {
+		return reconcile.Result{}, err
+	}
+	if err := r.rotateSecretKey(); err != nil {
+		return reconcile.Result{}, err
+	}
 	if err := r.validateSecrets(); err != nil {
 		return reconcile.Result{}, err
 	}
+	if err := r.validateFilestore(); err != nil {
+		return reconcile.Result{}, err
+	}
 
 	requeue := false
 
-	// these need to be executed in order, maps' order isn't guaranteed that's why we use a slice
-	allJobs := []func() *batchv1.Job{
-		r.jobForSentryUpgrader,
-		r.jobForSentryCreateUser,
+	// the configuration has to exist before any pod mounting it is created
+	cm, err := r.configMapForSentry()
+	if err != nil {
+		r.logger.Error(err, "Failed to render the sentry configuration.")
+		return reconcile.Result{}, err
+	}
+	r.configHash = hashOf(cm.Data)
+	found := &corev1.ConfigMap{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		r.logger.Info("Creating a new ConfigMap.", "ConfigMap.Namespace", cm.Namespace, "ConfigMap.Name", cm.Name)
+		err = r.client.Create(context.TODO(), cm)
+		if err != nil {
+			r.logger.Error(err, "Failed to create new ConfigMap.", "ConfigMap.Namespace", cm.Namespace, "ConfigMap.Name", cm.Name)
+			return reconcile.Result{}, err
+		}
+	} else if err != nil {
+		r.logger.Error(err, "Failed to get ConfigMap.", "ConfigMap.Name", cm.Name)
+		return reconcile.Result{}, err
+	} else {
+		r.logger.Info("ConfigMap already exists, updating to reconcile", "ConfigMap.Namespace", found.Namespace, "ConfigMap.Name", found.Name)
+		err = r.client.Update(context.TODO(), cm)
+		if err != nil {
+			r.logger.Error(err, "Failed to update ConfigMap.", "ConfigMap.Namespace", cm.Namespace, "ConfigMap.Name", cm.Name)
+			return reconcile.Result{}, err
+		}
 	}
 
-	for _, f := range allJobs {
-		job := f()
-		found := &batchv1.Job{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: job.Name, Namespace: r.sentry.Namespace}, found)
-		if err != nil && errors.IsNotFound(err) {
-			requeue = true
-			r.logger.Info("Creating a new Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
-			err := r.client.Create(context.TODO(), job)
-			if err != nil {
-				r.logger.Error(err, "Failed to create Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+	// don't start anything depending on postgres and redis until they're usable
+	ready, err := r.preflight()
+	if err != nil {
+		r.logger.Error(err, "Failed to run the preflight checks.")
+		return reconcile.Result{}, err
+	}
+	if !ready {
+		backoff := r.preflightBackoff()
+		r.logger.Info("Dependencies aren't ready, waiting.", "Backoff", backoff.String())
+		return reconcile.Result{RequeueAfter: backoff}, r.updateStatus("WaitingForDependencies")
+	}
+
+	// the migrations have to run before anything else uses the database
+	phase, err := r.migrate()
+	if err != nil {
+		r.logger.Error(err, "Failed to run the migrations.")
+		return reconcile.Result{}, err
+	}
+	switch phase {
+	case "":
+	case "UpgradeFailed", "UpgradeBlocked", "RollbackFailed", "VersionSkewBlocked":
+		// waiting for the spec to change
+		return reconcile.Result{}, r.updateStatus(phase)
+	default:
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, r.updateStatus(phase)
+	}
+
+	if r.sentry.Spec.Kafka != nil {
+		phase, err := r.ensureKafkaTopics()
+		if err != nil {
+			r.logger.Error(err, "Failed to create the kafka topics.")
+			return reconcile.Result{}, err
+		}
+		switch phase {
+		case "":
+		case "KafkaTopicsMissing":
+			return reconcile.Result{RequeueAfter: kafkaTopicsRetryDelay}, r.updateStatus(phase)
+		default:
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, r.updateStatus(phase)
+		}
+	}
+
+	// snuba has its own migrations, run the same way once ClickHouse answers
+	if sn := r.sentry.Spec.Snuba; sn != nil {
+		if sn.ClickHouse.Managed() {
+			if err := r.reconcileClickHouse(); err != nil {
 				return reconcile.Result{}, err
 			}
-			// we want to wait until the upgrader job has run before proceeding
-			if job.Name == "sentry-upgrader" {
-				err = wait.PollUntil(5*time.Second, r.checkIfJobIsCompleted(job.Name), context.TODO().Done())
-				if err != nil {
-					r.logger.Error(err, "Timed out waiting for job to complete.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
-					return reconcile.Result{}, err
-				}
-			}
-		} else if err != nil {
-			r.logger.Error(err, "Failed to get Job.", "Job.Name", job.Name)
+		}
+		ready, err := r.checkClickHouse()
+		if err != nil {
+			r.logger.Error(err, "Failed to check ClickHouse.")
 			return reconcile.Result{}, err
-		} else {
-			r.logger.Info("Job already exists, nothing to do.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
 		}
+		if !ready {
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, r.updateStatus("WaitingForClickHouse")
+		}
+
+		phase, err := r.migrateSnuba()
+		if err != nil {
+			r.logger.Error(err, "Failed to run the snuba migrations.")
+			return reconcile.Result{}, err
+		}
+		switch phase {
+		case "":
+		case "SnubaUpgradeFailed":
+			// waiting for the spec to change
+			return reconcile.Result{}, r.updateStatus(phase)
+		default:
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, r.updateStatus(phase)
+		}
+	}
+
+	// relay registers with its credentials, they have to exist before the
+	// sentry pods trusting them are rolled
+	if r.sentry.Spec.Relay != nil {
+		phase, err := r.ensureRelay()
+		if err != nil {
+			r.logger.Error(err, "Failed to reconcile relay.")
+			return reconcile.Result{}, err
+		}
+		switch phase {
+		case "":
+		default:
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, r.updateStatus(phase)
+		}
+	}
+
+	if err := r.superUser(); err != nil {
+		r.logger.Error(err, "Failed to reconcile the superuser.")
+		return reconcile.Result{}, err
+	}
+
+	rotating, err := r.planSecretKeyRollout()
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	upgrading, err := r.planBlueGreen()
+	if err != nil {
+		return reconcile.Result{}, err
 	}
 
-	allDeployments := []func() *appsv1.Deployment{
-		r.deploymentForSentryWebUI,
-		r.deploymentForSentryWorker,
-		r.deploymentForSentryCron,
+	allDeployments := r.sentryDeployments()
+	if r.sentry.Spec.Snuba != nil {
+		allDeployments = append(allDeployments, r.snubaDeployments()...)
+		allDeployments = append(allDeployments,
+			r.deploymentForSentryIngestConsumer,
+			r.deploymentForSentryPostProcessForwarder,
+		)
+	}
+	if r.sentry.Spec.Relay != nil {
+		allDeployments = append(allDeployments, r.deploymentForRelay)
 	}
 
+	stalled := []string{}
 	for _, f := range allDeployments {
 		dep := f()
+		r.applyRollout(dep)
 		// Check if the deployment already exists, if not create a new one
 		found := &appsv1.Deployment{}
 		err = r.client.Get(context.TODO(), types.NamespacedName{Name: dep.Name, Namespace: dep.Namespace}, found)
@@ -201,6 +719,12 @@ func (r *ReconcileSentry) Reconcile(request reconcile.Request) (reconcile.Result
 			return reconcile.Result{}, err
 		} else {
 			r.logger.Info("Deployment already exists, updating to reconcile", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
+			if rolloutStalled(found) {
+				stalled = append(stalled, found.Name)
+			}
+			if baseName(found.Name) == cronName && found.Spec.Replicas != nil && *found.Spec.Replicas > 1 {
+				r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "CronReplicasRefused", "%s must run a single replica, scaling it back from %d", found.Name, *found.Spec.Replicas)
+			}
 			err = r.client.Update(context.TODO(), dep)
 			if err != nil {
 				r.logger.Error(err, "Failed to update Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
@@ -209,10 +733,18 @@ func (r *ReconcileSentry) Reconcile(request reconcile.Request) (reconcile.Result
 		}
 	}
 
+	r.reportRollouts(stalled)
+
 	// only have one service right now but eh.
 	allServices := []func() *corev1.Service{
 		r.serviceForSentryWebUI,
 	}
+	if r.sentry.Spec.Snuba != nil {
+		allServices = append(allServices, r.serviceForSnubaAPI)
+	}
+	if r.sentry.Spec.Relay != nil {
+		allServices = append(allServices, r.serviceForRelay)
+	}
 
 	//expose the sentry services
 	for _, f := range allServices {
@@ -230,10 +762,99 @@ func (r *ReconcileSentry) Reconcile(request reconcile.Request) (reconcile.Result
 		} else if err != nil {
 			r.logger.Error(err, "Failed to get Service.", "Service.Name", svc.Name)
 			return reconcile.Result{}, err
+		} else if !reflect.DeepEqual(found.Spec.Selector, svc.Spec.Selector) {
+			// the web service moves between the sets of a blue/green upgrade
+			r.logger.Info("Service already exists, updating its selector", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+			found.Spec.Selector = svc.Spec.Selector
+			err = r.client.Update(context.TODO(), found)
+			if err != nil {
+				r.logger.Error(err, "Failed to update Service.", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+				return reconcile.Result{}, err
+			}
 		} else {
 			r.logger.Info("Service already exists, nothing else to do.", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
 		}
 	}
 
-	return reconcile.Result{Requeue: requeue}, nil
+	if err := r.reconcileMemcached(); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if r.sentry.Spec.Symbolicator != nil {
+		if err := r.reconcileSymbolicator(); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if err := r.reconcileIngress(); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	canary, err := r.canary(upgrading)
+	if err != nil {
+		r.logger.Error(err, "Failed to reconcile the canary.")
+		return reconcile.Result{}, err
+	}
+	if canary == "CanaryPromoted" {
+		// the promotion changed the spec, which brings us back
+		return reconcile.Result{}, nil
+	}
+
+	if err := r.cleanup(); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if rotating {
+		// check on the rollout again shortly
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, r.updateStatus("RotatingSecretKey")
+	}
+	if upgrading {
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, r.updateStatus("SwitchingSets")
+	}
+	if canary != "" {
+		// the analysis ends at a given time, nothing may change by then
+		return reconcile.Result{RequeueAfter: 30 * time.Second}, r.updateStatus(canary)
+	}
+	if r.sentry.Spec.RedisSentinel != nil {
+		// the pods have to follow a failover of the redis master
+		return reconcile.Result{Requeue: requeue, RequeueAfter: sentinelCheckInterval}, r.updateStatus("Running")
+	}
+	return reconcile.Result{Requeue: requeue}, r.updateStatus("Running")
+}
+
+// scales the sentry processes down to zero, leaving their spec untouched
+// so they come back as they were once resumed
+func (r *ReconcileSentry) scaleDown() error {
+	zero := int32(0)
+	for _, name := range Processes {
+		dep := &appsv1.Deployment{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: r.sentry.Namespace}, dep)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			r.logger.Error(err, "Failed to get Deployment.", "Deployment.Name", name)
+			return err
+		}
+		if dep.Spec.Replicas != nil && *dep.Spec.Replicas == 0 {
+			continue
+		}
+		r.logger.Info("Scaling down Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+		dep.Spec.Replicas = &zero
+		if err := r.client.Update(context.TODO(), dep); err != nil {
+			r.logger.Error(err, "Failed to update Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// records the phase along with the conditions gathered during this reconcile
+func (r *ReconcileSentry) updateStatus(phase string) error {
+	r.sentry.Status.Status = phase
+	err := r.client.Status().Update(context.TODO(), r.sentry)
+	if err != nil {
+		r.logger.Error(err, "Failed to update Sentry status.")
+	}
+	return err
 }
@@ -10,6 +10,19 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// the cron process schedules the periodic tasks, it must only run once
+const cronName = "sentry-cron"
+
+// Processes are the names of the deployments running sentry itself, which
+// are also the app label of their pods
+var Processes = []string{
+	"sentry-web-ui", "sentry-worker", "sentry-cron", "sentry-ingest-consumer", "sentry-post-process-forwarder",
+	// the second set of a blue/green upgrade
+	"sentry-web-ui" + greenSuffix, "sentry-worker" + greenSuffix, "sentry-cron" + greenSuffix,
+	// its pods carry the app label of the web pods
+	canaryName,
+}
+
 // deployment for the sentry web process
 func (r *ReconcileSentry) deploymentForSentryWebUI() *appsv1.Deployment {
 	name := "sentry-web-ui"
@@ -103,7 +116,7 @@ func (r *ReconcileSentry) deploymentForSentryWorker() *appsv1.Deployment {
 
 // deployment for the sentry cron process
 func (r *ReconcileSentry) deploymentForSentryCron() *appsv1.Deployment {
-	name := "sentry-cron"
+	name := cronName
 	replicas := int32(1)
 	opts := templateOpts{
 		Name: name,
@@ -113,6 +126,58 @@ func (r *ReconcileSentry) deploymentForSentryCron() *appsv1.Deployment {
 		},
 	}
 
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			// a rolling update would briefly run two schedulers, sending
+			// every periodic task twice
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
+			Template: r.getCommonPodTemplate(opts),
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, dep, r.scheme)
+	return dep
+}
+
+// deployment for the sentry ingest consumer, reading the events relayed
+// through kafka
+func (r *ReconcileSentry) deploymentForSentryIngestConsumer() *appsv1.Deployment {
+	return r.deploymentForSentryConsumer("sentry-ingest-consumer", []string{
+		"run",
+		"ingest-consumer",
+		"--all-consumer-types",
+	})
+}
+
+// deployment for the sentry post process forwarder, running the post
+// processing of the events snuba stored
+func (r *ReconcileSentry) deploymentForSentryPostProcessForwarder() *appsv1.Deployment {
+	return r.deploymentForSentryConsumer("sentry-post-process-forwarder", []string{
+		"run",
+		"post-process-forwarder",
+		"--commit-batch-size",
+		"1",
+	})
+}
+
+// deployment for a sentry process consuming from kafka
+func (r *ReconcileSentry) deploymentForSentryConsumer(name string, args []string) *appsv1.Deployment {
+	replicas := int32(1)
+	opts := templateOpts{
+		Name: name,
+		Args: args,
+	}
+
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
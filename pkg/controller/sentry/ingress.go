@@ -0,0 +1,118 @@
+package sentry
+
+import (
+	"context"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	ingressName = "sentry"
+	// the ingest endpoints all live under the id of their project
+	relayIngressPath = "/api/[1-9][0-9]*/"
+	// plain ingress paths are prefixes, the nginx ingress controller can
+	// match the relay path as a regular expression
+	useRegexAnnotation = "nginx.ingress.kubernetes.io/use-regex"
+)
+
+// ingress exposing sentry at its host name
+func (r *ReconcileSentry) ingressForSentry() *extensionsv1beta1.Ingress {
+	spec := r.sentry.Spec.Ingress
+	annotations := map[string]string{}
+	for key, value := range spec.Annotations {
+		annotations[key] = value
+	}
+	paths := []extensionsv1beta1.HTTPIngressPath{}
+	if r.sentry.Spec.Relay != nil {
+		annotations[useRegexAnnotation] = "true"
+		paths = append(paths, extensionsv1beta1.HTTPIngressPath{
+			Path: relayIngressPath,
+			Backend: extensionsv1beta1.IngressBackend{
+				ServiceName: relayName,
+				ServicePort: intstr.FromInt(relayPort),
+			},
+		})
+	}
+	paths = append(paths, extensionsv1beta1.HTTPIngressPath{
+		Path: "/",
+		Backend: extensionsv1beta1.IngressBackend{
+			ServiceName: "sentry-web-ui",
+			ServicePort: intstr.FromInt(9000),
+		},
+	})
+
+	ing := &extensionsv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ingressName,
+			Namespace:   r.sentry.Namespace,
+			Labels:      map[string]string{"app": "sentry"},
+			Annotations: annotations,
+		},
+		Spec: extensionsv1beta1.IngressSpec{
+			Rules: []extensionsv1beta1.IngressRule{{
+				Host: spec.Host,
+				IngressRuleValue: extensionsv1beta1.IngressRuleValue{
+					HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
+						Paths: paths,
+					},
+				},
+			}},
+		},
+	}
+	if spec.TLSSecretName != "" {
+		ing.Spec.TLS = []extensionsv1beta1.IngressTLS{{
+			Hosts:      []string{spec.Host},
+			SecretName: spec.TLSSecretName,
+		}}
+	}
+
+	controllerutil.SetControllerReference(r.sentry, ing, r.scheme)
+	return ing
+}
+
+// creates or updates the ingress, or deletes it when sentry isn't exposed
+// anymore
+func (r *ReconcileSentry) reconcileIngress() error {
+	found := &extensionsv1beta1.Ingress{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: ingressName, Namespace: r.sentry.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		r.logger.Error(err, "Failed to get Ingress.", "Ingress.Name", ingressName)
+		return err
+	}
+	exists := err == nil
+
+	if r.sentry.Spec.Ingress == nil {
+		if !exists {
+			return nil
+		}
+		r.logger.Info("Deleting Ingress.", "Ingress.Namespace", found.Namespace, "Ingress.Name", found.Name)
+		if err := r.client.Delete(context.TODO(), found); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "Failed to delete Ingress.", "Ingress.Namespace", found.Namespace, "Ingress.Name", found.Name)
+			return err
+		}
+		return nil
+	}
+
+	ing := r.ingressForSentry()
+	if !exists {
+		r.logger.Info("Creating a new Ingress.", "Ingress.Namespace", ing.Namespace, "Ingress.Name", ing.Name)
+		if err := r.client.Create(context.TODO(), ing); err != nil {
+			r.logger.Error(err, "Failed to create new Ingress.", "Ingress.Namespace", ing.Namespace, "Ingress.Name", ing.Name)
+			return err
+		}
+		return nil
+	}
+	r.logger.Info("Ingress already exists, updating to reconcile", "Ingress.Namespace", found.Namespace, "Ingress.Name", found.Name)
+	found.Annotations = ing.Annotations
+	found.Spec = ing.Spec
+	if err := r.client.Update(context.TODO(), found); err != nil {
+		r.logger.Error(err, "Failed to update Ingress.", "Ingress.Namespace", found.Namespace, "Ingress.Name", found.Name)
+		return err
+	}
+	return nil
+}
@@ -7,9 +7,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// UpgraderJobName is the name of the job running the migrations, deleting it
+// runs them again
+const UpgraderJobName = "sentry-upgrader"
+
 // job for the sentry upgrade process
 func (r *ReconcileSentry) jobForSentryUpgrader() *batchv1.Job {
-	name := "sentry-upgrader"
+	name := UpgraderJobName
 	restartPolicy := corev1.RestartPolicyOnFailure
 	opts := templateOpts{
 		Name: name,
@@ -33,60 +37,66 @@ func (r *ReconcileSentry) jobForSentryUpgrader() *batchv1.Job {
 	return job
 }
 
-// job for the sentry createuser process
-func (r *ReconcileSentry) jobForSentryCreateUser() *batchv1.Job {
-	name := "sentry-createuser"
+// checks that postgres accepts our credentials and the database exists
+const preflightScript = `
+import os
+import sys
+
+import psycopg2
+
+try:
+    psycopg2.connect(
+        host=os.environ['SENTRY_POSTGRES_HOST'],
+        port=os.environ['SENTRY_POSTGRES_PORT'],
+        dbname=os.environ['SENTRY_DB_NAME'],
+        user=os.environ['SENTRY_DB_USER'],
+        password=os.environ['SENTRY_DB_PASSWORD'],
+        connect_timeout=10,
+    ).close()
+except psycopg2.Error as e:
+    with open('/dev/termination-log', 'w') as f:
+        f.write(str(e).strip())
+    sys.exit(1)
+`
+
+// job for the database preflight check
+func (r *ReconcileSentry) jobForSentryPreflight() *batchv1.Job {
+	name := "sentry-preflight"
+	spec := r.sentry.Spec
 	restartPolicy := corev1.RestartPolicyNever
-	one := int32(1)
 	zero := int32(0)
+	deadline := int64(120)
 	opts := templateOpts{
 		Name: name,
 		Args: []string{
-			"createuser",
-			"--no-input",
-			"--superuser",
-			"--email",
-			"$(SENTRY_SU_EMAIL)",
-			"--password",
-			"$(SENTRY_SU_PASSWORD)",
-		},
-		ExtraEnv: []corev1.EnvVar{
-			{
-				Name: "SENTRY_SU_EMAIL",
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: &corev1.SecretKeySelector{
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: r.sentry.Spec.SentrySecret,
-						},
-						Key: r.sentry.Spec.SentrySuperUserEmailKey,
-					},
-				},
-			},
-			{
-				Name: "SENTRY_SU_PASSWORD",
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: &corev1.SecretKeySelector{
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: r.sentry.Spec.SentrySecret,
-						},
-						Key: r.sentry.Spec.SentrySuperUserPasswordKey,
-					},
-				},
-			},
+			"python",
+			"-c",
+			preflightScript,
 		},
 		RestartPolicy: &restartPolicy,
 	}
-	jobSpec := r.getCommonPodTemplate(opts)
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: r.sentry.Namespace,
+			Annotations: map[string]string{
+				hashAnnotation: hashOf([]interface{}{
+					spec.PostgresHost,
+					spec.PostgresPort,
+					spec.PostgresDB,
+					spec.PostgresUser,
+					spec.PostgresUserSecret,
+					spec.PostgresPasswordSecret,
+					spec.PostgresSSLMode,
+					spec.PostgresSSLRootCert,
+					spec.PostgresSSLClientSecret,
+				}),
+			},
 		},
 		Spec: batchv1.JobSpec{
-			Template:     jobSpec,
-			Parallelism:  &one,
-			Completions:  &one,
-			BackoffLimit: &zero,
+			Template:              r.getCommonPodTemplate(opts),
+			BackoffLimit:          &zero,
+			ActiveDeadlineSeconds: &deadline,
 		},
 	}
 
@@ -0,0 +1,231 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	kafkaCertsPath        = "/etc/sentry-operator/kafka"
+	kafkaTopicsJobName    = "sentry-kafka-topics"
+	kafkaTopicsRetryDelay = 2 * time.Minute
+)
+
+// the topics sentry and snuba produce to or consume from
+var kafkaTopics = []string{
+	"cdc",
+	"event-replacements",
+	"events",
+	"events-subscription-results",
+	"ingest-attachments",
+	"ingest-events",
+	"ingest-sessions",
+	"ingest-transactions",
+	"outcomes",
+	"snuba-commit-log",
+	"snuba-queries",
+	"snuba-sessions-commit-log",
+	"snuba-transactions-commit-log",
+	"transactions-subscription-results",
+}
+
+// creates the missing topics, then lists the topics and reports the ones
+// still missing in the termination message
+const kafkaTopicsScript = `set -e
+props=/tmp/client.properties
+echo "security.protocol=$KAFKA_SECURITY_PROTOCOL" > $props
+if [ -n "$KAFKA_SASL_MECHANISM" ]; then
+  case "$KAFKA_SASL_MECHANISM" in
+    PLAIN) module=org.apache.kafka.common.security.plain.PlainLoginModule ;;
+    *) module=org.apache.kafka.common.security.scram.ScramLoginModule ;;
+  esac
+  echo "sasl.mechanism=$KAFKA_SASL_MECHANISM" >> $props
+  echo "sasl.jaas.config=$module required username=\"$KAFKA_SASL_USERNAME\" password=\"$KAFKA_SASL_PASSWORD\";" >> $props
+fi
+if [ -n "$KAFKA_SSL_CA_LOCATION" ]; then
+  echo "ssl.truststore.type=PEM" >> $props
+  echo "ssl.truststore.location=$KAFKA_SSL_CA_LOCATION" >> $props
+fi
+topics() { kafka-topics.sh --bootstrap-server "$KAFKA_BOOTSTRAP_SERVERS" --command-config $props "$@"; }
+
+for spec in $KAFKA_TOPICS; do
+  topics --create --if-not-exists --topic "${spec%:*}" --partitions "${spec#*:}" --replication-factor "$KAFKA_REPLICATION_FACTOR" || true
+done
+
+existing=$(topics --list)
+missing=""
+for spec in $KAFKA_TOPICS; do
+  echo "$existing" | grep -qx "${spec%:*}" || missing="$missing ${spec%:*}"
+done
+if [ -n "$missing" ]; then
+  echo "missing topics:$missing" | tee /dev/termination-log
+  exit 1
+fi
+`
+
+// returns the volumes, mounts and environment letting a kafka client honour
+// the security settings
+func kafkaClient(k *v1alpha1.KafkaSpec) ([]corev1.Volume, []corev1.VolumeMount, []corev1.EnvVar) {
+	volumes := []corev1.Volume{}
+	mounts := []corev1.VolumeMount{}
+	env := []corev1.EnvVar{
+		{
+			Name:  "KAFKA_BOOTSTRAP_SERVERS",
+			Value: strings.Join(k.BootstrapServers, ","),
+		},
+		{
+			Name:  "KAFKA_SECURITY_PROTOCOL",
+			Value: k.SecurityProtocol,
+		},
+	}
+	if ca := k.SSLRootCert; ca != nil {
+		volumes = append(volumes, certificateVolume("kafka-ca", ca))
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "kafka-ca",
+			MountPath: kafkaCertsPath + "/ca",
+			ReadOnly:  true,
+		})
+		env = append(env, corev1.EnvVar{
+			Name:  "KAFKA_SSL_CA_LOCATION",
+			Value: kafkaCertsPath + "/ca/ca.crt",
+		})
+	}
+	if sasl := k.SASL; sasl != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  "KAFKA_SASL_MECHANISM",
+			Value: sasl.Mechanism,
+		}, corev1.EnvVar{
+			Name:  "KAFKA_SASL_USERNAME",
+			Value: sasl.Username,
+		}, secretEnv("KAFKA_SASL_PASSWORD", sasl.PasswordSecret))
+	}
+	return volumes, mounts, env
+}
+
+// returns the topics to create along with their partitions, sorted by name
+func kafkaTopicPartitions(k *v1alpha1.KafkaSpec) []string {
+	partitions := map[string]int{}
+	for _, topic := range kafkaTopics {
+		partitions[topic] = k.Topics.Partitions
+	}
+	for topic, n := range k.Topics.TopicPartitions {
+		partitions[topic] = n
+	}
+	topics := []string{}
+	for topic, n := range partitions {
+		topics = append(topics, fmt.Sprintf("%s:%d", topic, n))
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// job creating the missing kafka topics
+func (r *ReconcileSentry) jobForKafkaTopics() *batchv1.Job {
+	name := kafkaTopicsJobName
+	k := r.sentry.Spec.Kafka
+	topics := kafkaTopicPartitions(k)
+	volumes, mounts, env := kafkaClient(k)
+	env = append(env, corev1.EnvVar{
+		Name:  "KAFKA_TOPICS",
+		Value: strings.Join(topics, " "),
+	}, corev1.EnvVar{
+		Name:  "KAFKA_REPLICATION_FACTOR",
+		Value: fmt.Sprintf("%d", k.Topics.ReplicationFactor),
+	})
+	labels := map[string]string{"app": name}
+	backoffLimit := int32(2)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.sentry.Namespace,
+			Annotations: map[string]string{
+				hashAnnotation: hashOf([]interface{}{k, topics}),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:            name,
+						Image:           k.Topics.Image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Command:         []string{"/bin/bash", "-c", kafkaTopicsScript},
+						Env:             env,
+						VolumeMounts:    mounts,
+					}},
+					Volumes:       volumes,
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, job, r.scheme)
+	return job
+}
+
+// makes sure the kafka topics exist; returns the phase to report until they do
+func (r *ReconcileSentry) ensureKafkaTopics() (string, error) {
+	status := &r.sentry.Status
+
+	want := r.jobForKafkaTopics()
+	job, state, err := r.getJobState(want.Name)
+	if err != nil {
+		return "", err
+	}
+	if job != nil && job.Annotations[hashAnnotation] != want.Annotations[hashAnnotation] {
+		// the kafka settings changed since the last run, start over
+		status.SetCondition(v1alpha1.ConditionKafkaTopicsReady, corev1.ConditionUnknown, "Checking", "the kafka settings changed")
+		return "CreatingKafkaTopics", r.deleteJob(job)
+	}
+
+	switch state {
+	case JobMissing:
+		r.logger.Info("Creating a new Job.", "Job.Namespace", want.Namespace, "Job.Name", want.Name)
+		if err := r.client.Create(context.TODO(), want); err != nil {
+			r.logger.Error(err, "Failed to create Job.", "Job.Namespace", want.Namespace, "Job.Name", want.Name)
+			return "", err
+		}
+		fallthrough
+	case JobRunning:
+		// keep reporting the previous failure while retrying
+		if c := status.GetCondition(v1alpha1.ConditionKafkaTopicsReady); c == nil || c.Status != corev1.ConditionFalse {
+			status.SetCondition(v1alpha1.ConditionKafkaTopicsReady, corev1.ConditionUnknown, "Checking", "waiting for the kafka topics job to finish")
+		}
+		return "CreatingKafkaTopics", nil
+	case JobFailed:
+		message := r.jobTerminationMessage(want.Name)
+		status.MissingKafkaTopics = nil
+		if strings.HasPrefix(message, "missing topics:") {
+			status.MissingKafkaTopics = strings.Fields(strings.TrimPrefix(message, "missing topics:"))
+		}
+		if message == "" {
+			message = "creating the kafka topics failed, see the logs of job " + want.Name
+		}
+		status.SetCondition(v1alpha1.ConditionKafkaTopicsReady, corev1.ConditionFalse, "TopicsMissing", message)
+		// give it another go once in a while
+		for _, cond := range job.Status.Conditions {
+			if cond.Type == batchv1.JobFailed && time.Since(cond.LastTransitionTime.Time) > kafkaTopicsRetryDelay {
+				return "KafkaTopicsMissing", r.deleteJob(job)
+			}
+		}
+		return "KafkaTopicsMissing", nil
+	}
+
+	status.MissingKafkaTopics = nil
+	status.SetCondition(v1alpha1.ConditionKafkaTopicsReady, corev1.ConditionTrue, "Ready", fmt.Sprintf("the %d topics exist", len(kafkaTopicPartitions(r.sentry.Spec.Kafka))))
+	return "", nil
+}
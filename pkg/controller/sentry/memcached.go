@@ -0,0 +1,230 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const memcachedName = "sentry-memcached"
+
+// returns the host:port of every memcached server, django spreads the keys
+// over them so each managed replica is listed by its own name
+func (r *ReconcileSentry) memcachedServers() []string {
+	m := r.sentry.Spec.Memcached
+	if !m.Managed() {
+		return []string{fmt.Sprintf("%s:%d", m.Host, m.Port)}
+	}
+	servers := []string{}
+	for i := 0; i < m.Replicas; i++ {
+		servers = append(servers, fmt.Sprintf("%s-%d.%s:%d", memcachedName, i, memcachedName, m.Port))
+	}
+	return servers
+}
+
+// statefulset for the memcached cache tier, it gives the replicas the stable
+// names the sentry pods address them by
+func (r *ReconcileSentry) statefulSetForMemcached() *appsv1.StatefulSet {
+	m := r.sentry.Spec.Memcached
+	replicas := int32(m.Replicas)
+	labels := map[string]string{"app": memcachedName}
+	// leave some headroom over the item memory for connections and bookkeeping
+	memory := resource.MustParse(fmt.Sprintf("%dMi", m.MemoryMB+m.MemoryMB/4+16))
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      memcachedName,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: memcachedName,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			// the replicas don't depend on each other
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image: m.Image,
+						Name:  memcachedName,
+						Args: []string{
+							"-m",
+							fmt.Sprintf("%d", m.MemoryMB),
+							"-p",
+							fmt.Sprintf("%d", m.Port),
+						},
+						Ports: []corev1.ContainerPort{
+							{
+								ContainerPort: int32(m.Port),
+								Protocol:      "TCP",
+							},
+						},
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceMemory: memory,
+							},
+							Limits: corev1.ResourceList{
+								corev1.ResourceMemory: memory,
+							},
+						},
+						LivenessProbe: &corev1.Probe{
+							InitialDelaySeconds: int32(3),
+							Handler: corev1.Handler{
+								TCPSocket: &corev1.TCPSocketAction{
+									Port: intstr.IntOrString{
+										IntVal: int32(m.Port),
+									},
+								},
+							},
+							PeriodSeconds: int32(10),
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	if rs := r.sentry.Spec.Rollouts.Memcached; rs != nil {
+		sts.Spec.RevisionHistoryLimit = rs.RevisionHistoryLimit
+	}
+
+	controllerutil.SetControllerReference(r.sentry, sts, r.scheme)
+	return sts
+}
+
+// headless service giving each memcached replica its own DNS name
+func (r *ReconcileSentry) serviceForMemcached() *corev1.Service {
+	labels := map[string]string{"app": memcachedName}
+	port := int32(r.sentry.Spec.Memcached.Port)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:    labels,
+			Name:      memcachedName,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  labels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:     "memcached",
+					Port:     port,
+					Protocol: "TCP",
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, svc, r.scheme)
+	return svc
+}
+
+// creates or updates the managed memcached, or deletes it when memcached is
+// external or disabled
+func (r *ReconcileSentry) reconcileMemcached() error {
+	if m := r.sentry.Spec.Memcached; m == nil || !m.Managed() {
+		if err := r.deleteMemcached(&appsv1.StatefulSet{}); err != nil {
+			return err
+		}
+		return r.deleteMemcached(&corev1.Service{})
+	}
+
+	sts := r.statefulSetForMemcached()
+	found := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		r.logger.Info("Creating a new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+		if err := r.client.Create(context.TODO(), sts); err != nil {
+			r.logger.Error(err, "Failed to create new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+			return err
+		}
+	} else if err != nil {
+		r.logger.Error(err, "Failed to get StatefulSet.", "StatefulSet.Name", sts.Name)
+		return err
+	} else {
+		r.logger.Info("StatefulSet already exists, updating to reconcile", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+		found.Spec.Replicas = sts.Spec.Replicas
+		found.Spec.Template = sts.Spec.Template
+		found.Spec.UpdateStrategy = sts.Spec.UpdateStrategy
+		found.Spec.RevisionHistoryLimit = sts.Spec.RevisionHistoryLimit
+		if err := r.client.Update(context.TODO(), found); err != nil {
+			r.logger.Error(err, "Failed to update StatefulSet.", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+			return err
+		}
+	}
+
+	svc := r.serviceForMemcached()
+	foundSvc := &corev1.Service{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, foundSvc)
+	if err != nil && !errors.IsNotFound(err) {
+		r.logger.Error(err, "Failed to get Service.", "Service.Name", svc.Name)
+		return err
+	}
+	if err == nil {
+		if foundSvc.Spec.ClusterIP == corev1.ClusterIPNone {
+			return nil
+		}
+		// the cluster IP of a service can't be removed, it's created again
+		// headless
+		if !metav1.IsControlledBy(foundSvc, r.sentry) {
+			return fmt.Errorf("service %s isn't managed by the operator, it can't be replaced with a headless one", svc.Name)
+		}
+		r.logger.Info("Deleting Service.", "Service.Namespace", foundSvc.Namespace, "Service.Name", foundSvc.Name)
+		if err := r.client.Delete(context.TODO(), foundSvc); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "Failed to delete Service.", "Service.Namespace", foundSvc.Namespace, "Service.Name", foundSvc.Name)
+			return err
+		}
+	}
+	r.logger.Info("Creating a new Service.", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+	if err := r.client.Create(context.TODO(), svc); err != nil {
+		r.logger.Error(err, "Failed to create new Service.", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+		return err
+	}
+	return nil
+}
+
+// deletes the memcached object of the given kind when the operator manages
+// it, an external memcached may go by the same name
+func (r *ReconcileSentry) deleteMemcached(obj runtime.Object) error {
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", obj), "*v1.")
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: memcachedName, Namespace: r.sentry.Namespace}, obj)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		r.logger.Error(err, fmt.Sprintf("Failed to get %s.", kind), kind+".Name", memcachedName)
+		return err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(accessor, r.sentry) {
+		return nil
+	}
+	r.logger.Info(fmt.Sprintf("Deleting %s.", kind), kind+".Namespace", r.sentry.Namespace, kind+".Name", memcachedName)
+	if err := r.client.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+		r.logger.Error(err, fmt.Sprintf("Failed to delete %s.", kind), kind+".Namespace", r.sentry.Namespace, kind+".Name", memcachedName)
+		return err
+	}
+	return nil
+}
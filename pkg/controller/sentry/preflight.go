@@ -0,0 +1,269 @@
+package sentry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	dialTimeout         = 5 * time.Second
+	minPreflightBackoff = 5 * time.Second
+	maxPreflightBackoff = 5 * time.Minute
+	// how often sentinel is asked whether the redis master moved
+	sentinelCheckInterval = 30 * time.Second
+)
+
+// checks that postgres and redis are usable before anything depending on them
+// is rolled out, the results are recorded as conditions
+func (r *ReconcileSentry) preflight() (bool, error) {
+	status := &r.sentry.Status
+
+	if reason, err := r.checkRedis(); err != nil {
+		r.logger.Info("Redis preflight check failed.", "Reason", reason, "Error", err.Error())
+		status.SetCondition(v1alpha1.ConditionRedisReady, corev1.ConditionFalse, reason, err.Error())
+	} else {
+		status.SetCondition(v1alpha1.ConditionRedisReady, corev1.ConditionTrue, "Ready", "redis answered to PING")
+	}
+
+	if err := r.checkPostgres(); err != nil {
+		return false, err
+	}
+
+	return status.IsConditionTrue(v1alpha1.ConditionRedisReady) && status.IsConditionTrue(v1alpha1.ConditionPostgresReady), nil
+}
+
+// returns how long to wait before checking again, growing with the time
+// the dependencies have been failing
+func (r *ReconcileSentry) preflightBackoff() time.Duration {
+	backoff := minPreflightBackoff
+	for _, t := range []v1alpha1.SentryConditionType{v1alpha1.ConditionPostgresReady, v1alpha1.ConditionRedisReady} {
+		c := r.sentry.Status.GetCondition(t)
+		if c == nil || c.Status != corev1.ConditionFalse {
+			continue
+		}
+		if failing := time.Since(c.LastTransitionTime.Time); failing > backoff {
+			backoff = failing
+		}
+	}
+	if backoff > maxPreflightBackoff {
+		backoff = maxPreflightBackoff
+	}
+	return backoff
+}
+
+// the database is first checked over TCP from here, authentication and the
+// existence of the database are checked by a job running libpq so that the
+// TLS settings are honoured the same way sentry does
+func (r *ReconcileSentry) checkPostgres() error {
+	status := &r.sentry.Status
+	spec := r.sentry.Spec
+
+	address := net.JoinHostPort(spec.PostgresHost, strconv.Itoa(spec.PostgresPort))
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		r.logger.Info("Postgres preflight check failed.", "Reason", "Unreachable", "Error", err.Error())
+		status.SetCondition(v1alpha1.ConditionPostgresReady, corev1.ConditionFalse, "Unreachable", err.Error())
+		return nil
+	}
+	conn.Close()
+
+	want := r.jobForSentryPreflight()
+	job, state, err := r.getJobState(want.Name)
+	if err != nil {
+		return err
+	}
+	if job != nil && job.Annotations[hashAnnotation] != want.Annotations[hashAnnotation] {
+		// the connection settings changed since the last check, start over
+		if err := r.deleteJob(job); err != nil {
+			return err
+		}
+		status.SetCondition(v1alpha1.ConditionPostgresReady, corev1.ConditionUnknown, "Checking", "the database settings changed")
+		return nil
+	}
+
+	switch state {
+	case JobMissing:
+		r.logger.Info("Creating a new Job.", "Job.Namespace", want.Namespace, "Job.Name", want.Name)
+		if err := r.client.Create(context.TODO(), want); err != nil {
+			return err
+		}
+		fallthrough
+	case JobRunning:
+		// keep reporting the previous failure while retrying
+		if c := status.GetCondition(v1alpha1.ConditionPostgresReady); c == nil || c.Status != corev1.ConditionFalse || c.Reason == "Unreachable" {
+			status.SetCondition(v1alpha1.ConditionPostgresReady, corev1.ConditionUnknown, "Checking", "waiting for the database check to finish")
+		}
+	case JobComplete:
+		status.SetCondition(v1alpha1.ConditionPostgresReady, corev1.ConditionTrue, "Ready", fmt.Sprintf("connected to database '%s' on %s", spec.PostgresDB, address))
+	case JobFailed:
+		message := r.jobTerminationMessage(want.Name)
+		if message == "" {
+			message = "the database check failed, see the logs of job " + want.Name
+		}
+		r.logger.Info("Postgres preflight check failed.", "Reason", "ConnectionFailed", "Error", message)
+		status.SetCondition(v1alpha1.ConditionPostgresReady, corev1.ConditionFalse, "ConnectionFailed", message)
+		// it will be created again on the next attempt
+		return r.deleteJob(job)
+	}
+	return nil
+}
+
+// connects to redis, optionally through sentinel, and makes sure it accepts
+// our password, database and a PING; returns a reason on failure
+func (r *ReconcileSentry) checkRedis() (string, error) {
+	spec := r.sentry.Spec
+
+	password := ""
+	if sel := spec.RedisPasswordSecret; sel != nil {
+		value, err := r.readSecretKey(sel)
+		if err != nil {
+			return "MissingCredentials", err
+		}
+		password = value
+	}
+
+	var tlsConfig *tls.Config
+	address := net.JoinHostPort(spec.RedisHost, strconv.Itoa(spec.RedisPort))
+	if s := spec.RedisSentinel; s != nil {
+		master, err := sentinelMaster(s)
+		if err != nil {
+			return "SentinelUnavailable", err
+		}
+		if status := &r.sentry.Status; status.RedisMaster != master {
+			// the pods only resolve the master when they start, the new one
+			// in their environment rolls them out again
+			if status.RedisMaster != "" {
+				r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "RedisFailover", "Redis master moved from %s to %s, restarting the pods", status.RedisMaster, master)
+			}
+			status.RedisMaster = master
+		}
+		address = master
+	}
+	if spec.RedisTLS {
+		host, _, _ := net.SplitHostPort(address)
+		tlsConfig = &tls.Config{ServerName: host}
+		if src := spec.RedisSSLRootCert; src != nil {
+			bundle, err := r.readCertificate(src)
+			if err != nil {
+				return "MissingCertificate", err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(bundle) {
+				return "InvalidCertificate", fmt.Errorf("no certificate found in the redis CA bundle")
+			}
+		}
+	}
+
+	conn, err := dialRedis(address, tlsConfig)
+	if err != nil {
+		return "Unreachable", err
+	}
+	defer conn.Close()
+
+	if password != "" {
+		if _, err := conn.Do("AUTH", password); err != nil {
+			return "AuthenticationFailed", err
+		}
+	}
+	if _, err := conn.Do("SELECT", spec.RedisDB); err != nil {
+		return "SelectFailed", err
+	}
+	if _, err := conn.Do("PING"); err != nil {
+		return "PingFailed", err
+	}
+	return "", nil
+}
+
+// splits the address of a sentinel, a bare host listens on 26379
+func sentinelHostPort(address string) (string, int, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		if strings.Contains(address, ":") && net.ParseIP(address) == nil {
+			return "", 0, err
+		}
+		host, port = address, "26379"
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("the host is missing")
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return "", 0, fmt.Errorf("the port has to be a number between 1 and 65535")
+	}
+	return host, p, nil
+}
+
+// asks the sentinels in turn for the address of the master
+func sentinelMaster(s *v1alpha1.RedisSentinelSpec) (string, error) {
+	var lastErr error
+	for _, address := range s.Addresses {
+		host, port, err := sentinelHostPort(address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		address = net.JoinHostPort(host, strconv.Itoa(port))
+		conn, err := dialRedis(address, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reply, err := conn.Do("SENTINEL", "get-master-addr-by-name", s.MasterName)
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(reply) != 2 {
+			lastErr = fmt.Errorf("sentinel %s doesn't know master '%s'", address, s.MasterName)
+			continue
+		}
+		return net.JoinHostPort(reply[0], reply[1]), nil
+	}
+	return "", lastErr
+}
+
+// reads the value of a secret key
+func (r *ReconcileSentry) readSecretKey(sel *corev1.SecretKeySelector) (string, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: r.sentry.Namespace, Name: sel.Name}, secret)
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[sel.Key]
+	if !ok {
+		return "", fmt.Errorf("key '%s' is missing from secret '%s'", sel.Key, sel.Name)
+	}
+	return string(value), nil
+}
+
+// reads a CA bundle from its secret or config map
+func (r *ReconcileSentry) readCertificate(src *v1alpha1.CertificateSource) ([]byte, error) {
+	if src.ConfigMapName != "" {
+		cm := &corev1.ConfigMap{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: r.sentry.Namespace, Name: src.ConfigMapName}, cm)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := cm.Data[src.Key]
+		if !ok {
+			return nil, fmt.Errorf("key '%s' is missing from config map '%s'", src.Key, src.ConfigMapName)
+		}
+		return []byte(value), nil
+	}
+	value, err := r.readSecretKey(&corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: src.SecretName},
+		Key:                  src.Key,
+	})
+	return []byte(value), err
+}
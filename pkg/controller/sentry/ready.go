@@ -7,26 +7,117 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func (r *ReconcileSentry) checkIfJobIsCompleted(name string) func() (bool, error) {
-	return func() (bool, error) {
-		r.logger.Info(fmt.Sprintf("checking if job '%s' has completed", name))
-		ns := r.sentry.Namespace
-		job := &batchv1.Job{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: ns}, job)
-		if err != nil {
-			if errors.IsNotFound(err) {
-				return false, fmt.Errorf("the job '%s' was not found in namespace '%s'", name, ns)
-			}
-			return false, err
+// JobState tells how far a job got
+type JobState int
+
+const (
+	// JobMissing means the job doesn't exist
+	JobMissing JobState = iota
+	// JobRunning means the job hasn't finished yet
+	JobRunning
+	// JobComplete means the job succeeded
+	JobComplete
+	// JobFailed means the job gave up
+	JobFailed
+)
+
+// GetJobState returns the job with the given name and how far it got
+func GetJobState(c client.Client, namespace, name string) (*batchv1.Job, JobState, error) {
+	job := &batchv1.Job{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, job)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, JobMissing, nil
+		}
+		return nil, JobMissing, err
+	}
+	return job, jobStateOf(job), nil
+}
+
+// returns how far a job got from its conditions
+func jobStateOf(job *batchv1.Job) JobState {
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return JobComplete
+		case batchv1.JobFailed:
+			return JobFailed
 		}
-		for _, c := range job.Status.Conditions {
-			if c.Type == batchv1.JobComplete && c.Status == corev1.ConditionTrue {
-				return true, nil
+	}
+	return JobRunning
+}
+
+// JobTerminationMessage returns the termination message left by the pod of a
+// job that succeeded, or else by its newest pod
+func JobTerminationMessage(c client.Client, namespace, name string) (string, error) {
+	pods := &corev1.PodList{}
+	opts := client.InNamespace(namespace).MatchingLabels(map[string]string{"job-name": name})
+	if err := c.List(context.TODO(), opts, pods); err != nil {
+		return "", err
+	}
+	return terminationMessage(pods.Items), nil
+}
+
+// picks the termination message of the pod that succeeded, the pods of a job
+// are listed in no particular order so otherwise the newest one with a message
+// tells the last attempt
+func terminationMessage(pods []corev1.Pod) string {
+	var newest *corev1.Pod
+	message := ""
+	for i := range pods {
+		pod := &pods[i]
+		for _, status := range pod.Status.ContainerStatuses {
+			t := status.State.Terminated
+			if t == nil || t.Message == "" {
+				continue
+			}
+			if pod.Status.Phase == corev1.PodSucceeded {
+				return t.Message
+			}
+			if newest == nil || newest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+				newest = pod
+				message = t.Message
 			}
 		}
-		return false, nil
 	}
+	return message
+}
+
+// DeleteJob deletes a job along with its pods
+func DeleteJob(c client.Client, job *batchv1.Job) error {
+	err := c.Delete(context.TODO(), job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// returns the job with the given name and how far it got
+func (r *ReconcileSentry) getJobState(name string) (*batchv1.Job, JobState, error) {
+	r.logger.Info(fmt.Sprintf("checking if job '%s' has completed", name))
+	return GetJobState(r.client, r.sentry.Namespace, name)
+}
+
+// returns the termination message left by the pod of a job that succeeded,
+// or else by its newest pod
+func (r *ReconcileSentry) jobTerminationMessage(name string) string {
+	message, err := JobTerminationMessage(r.client, r.sentry.Namespace, name)
+	if err != nil {
+		r.logger.Error(err, "Failed to list the pods of Job.", "Job.Name", name)
+	}
+	return message
+}
+
+// deletes a job along with its pods
+func (r *ReconcileSentry) deleteJob(job *batchv1.Job) error {
+	r.logger.Info("Deleting Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+	return DeleteJob(r.client, job)
 }
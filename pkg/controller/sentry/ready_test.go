@@ -0,0 +1,71 @@
+package sentry
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// returns a pod of a job created the given number of minutes after the first
+// one, its container terminated with message
+func jobPod(minutes int, phase corev1.PodPhase, message string) corev1.Pod {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			CreationTimestamp: metav1.Time{Time: start.Add(time.Duration(minutes) * time.Minute)},
+		},
+		Status: corev1.PodStatus{
+			Phase: phase,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{Message: message},
+				},
+			}},
+		},
+	}
+}
+
+func TestTerminationMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		pods []corev1.Pod
+		want string
+	}{
+		{"no pods", nil, ""},
+		{
+			"newest failure",
+			[]corev1.Pod{
+				jobPod(2, corev1.PodFailed, "second"),
+				jobPod(3, corev1.PodFailed, "third"),
+				jobPod(1, corev1.PodFailed, "first"),
+			},
+			"third",
+		},
+		{
+			"succeeded pod",
+			[]corev1.Pod{
+				jobPod(1, corev1.PodFailed, "first"),
+				jobPod(2, corev1.PodSucceeded, "second"),
+				jobPod(3, corev1.PodFailed, "third"),
+			},
+			"second",
+		},
+		{
+			"newest pod without a message",
+			[]corev1.Pod{
+				jobPod(1, corev1.PodFailed, "first"),
+				jobPod(2, corev1.PodFailed, ""),
+			},
+			"first",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := terminationMessage(tt.pods); got != tt.want {
+				t.Errorf("terminationMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package sentry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	relayName           = "sentry-relay"
+	relayPort           = 3000
+	relayConfigPath     = "/work/.relay"
+	relayCredentialsJob = "sentry-relay-credentials"
+	// keys of the relay secret
+	relayConfigKey      = "config.yml"
+	relayCredentialsKey = "credentials.json"
+	relayPublicKeyKey   = "public_key"
+)
+
+// the credentials relay authenticates against sentry with
+type relayCredentials struct {
+	SecretKey string `json:"secret_key"`
+	PublicKey string `json:"public_key"`
+	ID        string `json:"id"`
+}
+
+// job generating the relay credentials, they're handed over through the
+// termination message and the job is deleted once they're stored
+func (r *ReconcileSentry) jobForRelayCredentials() *batchv1.Job {
+	name := relayCredentialsJob
+	labels := map[string]string{"app": name}
+	backoffLimit := int32(2)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:            name,
+						Image:           r.sentry.Spec.Relay.Image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Command: []string{
+							"/bin/sh",
+							"-c",
+							"relay credentials generate --stdout > /dev/termination-log",
+						},
+					}},
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, job, r.scheme)
+	return job
+}
+
+// makes sure the relay secret holds credentials and the current relay
+// configuration; returns the phase to report until it does
+func (r *ReconcileSentry) ensureRelay() (string, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: relayName, Namespace: r.sentry.Namespace}, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		r.logger.Error(err, "Failed to get Secret.", "Secret.Name", relayName)
+		return "", err
+	}
+	exists := err == nil
+
+	if !exists || len(secret.Data[relayCredentialsKey]) == 0 {
+		credentials, phase, err := r.generateRelayCredentials()
+		if credentials == nil || err != nil {
+			return phase, err
+		}
+		if !exists {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      relayName,
+					Namespace: r.sentry.Namespace,
+					Labels:    map[string]string{"app": relayName},
+				},
+				Data: map[string][]byte{},
+			}
+			controllerutil.SetControllerReference(r.sentry, secret, r.scheme)
+		}
+		data, _ := json.Marshal(credentials)
+		secret.Data[relayCredentialsKey] = data
+		secret.Data[relayPublicKeyKey] = []byte(credentials.PublicKey)
+		r.recorder.Eventf(r.sentry, corev1.EventTypeNormal, "RelayRegistered", "Generated the credentials of relay %s", credentials.ID)
+	}
+
+	config, err := r.renderRelayConfig()
+	if err != nil {
+		return "", err
+	}
+	secret.Data[relayConfigKey] = []byte(config)
+
+	if !exists {
+		r.logger.Info("Creating a new Secret.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.client.Create(context.TODO(), secret); err != nil {
+			r.logger.Error(err, "Failed to create new Secret.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return "", err
+		}
+	} else {
+		r.logger.Info("Secret already exists, updating to reconcile", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.client.Update(context.TODO(), secret); err != nil {
+			r.logger.Error(err, "Failed to update Secret.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return "", err
+		}
+	}
+	r.relayConfigHash = hashOf(secret.Data)
+
+	// the credentials are stored, the job and its termination message can go
+	job, _, err := r.getJobState(relayCredentialsJob)
+	if err != nil {
+		return "", err
+	}
+	if job != nil {
+		return "", r.deleteJob(job)
+	}
+	return "", nil
+}
+
+// runs the credentials job; returns the credentials once it completed or the
+// phase to report until then
+func (r *ReconcileSentry) generateRelayCredentials() (*relayCredentials, string, error) {
+	job, state, err := r.getJobState(relayCredentialsJob)
+	if err != nil {
+		return nil, "", err
+	}
+	switch state {
+	case JobMissing:
+		job = r.jobForRelayCredentials()
+		r.logger.Info("Creating a new Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.client.Create(context.TODO(), job); err != nil {
+			r.logger.Error(err, "Failed to create Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return nil, "", err
+		}
+		return nil, "GeneratingRelayCredentials", nil
+	case JobRunning:
+		return nil, "GeneratingRelayCredentials", nil
+	case JobFailed:
+		r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "RelayCredentialsFailed", "Generating the relay credentials failed, see the logs of job %s", relayCredentialsJob)
+		// it will be created again on the next attempt
+		return nil, "RelayCredentialsFailed", r.deleteJob(job)
+	}
+
+	credentials := &relayCredentials{}
+	message := r.jobTerminationMessage(relayCredentialsJob)
+	if err := json.Unmarshal([]byte(message), credentials); err != nil || credentials.SecretKey == "" || credentials.PublicKey == "" {
+		r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "RelayCredentialsFailed", "Job %s didn't output relay credentials", relayCredentialsJob)
+		return nil, "RelayCredentialsFailed", r.deleteJob(job)
+	}
+	return credentials, "", nil
+}
+
+// renders the relay configuration, it holds the redis and kafka passwords so
+// it lives in a secret; values are written as JSON which YAML reads just the
+// same
+func (r *ReconcileSentry) renderRelayConfig() (string, error) {
+	spec := r.sentry.Spec
+
+	redis := &url.URL{
+		Scheme: "redis",
+		Host:   fmt.Sprintf("%s:%d", spec.RedisHost, spec.RedisPort),
+		Path:   "/" + spec.RedisDB,
+	}
+	if sel := spec.RedisPasswordSecret; sel != nil {
+		password, err := r.readSecretKey(sel)
+		if err != nil {
+			return "", err
+		}
+		redis.User = url.UserPassword("", password)
+	}
+
+	type option struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}
+	k := spec.Kafka
+	kafka := []option{
+		{"bootstrap.servers", strings.Join(k.BootstrapServers, ",")},
+		{"security.protocol", k.SecurityProtocol},
+		{"message.max.bytes", 50000000},
+	}
+	if k.SSLRootCert != nil {
+		kafka = append(kafka, option{"ssl.ca.location", kafkaCertsPath + "/ca/ca.crt"})
+	}
+	if sasl := k.SASL; sasl != nil {
+		password, err := r.readSecretKey(sasl.PasswordSecret)
+		if err != nil {
+			return "", err
+		}
+		kafka = append(kafka,
+			option{"sasl.mechanism", sasl.Mechanism},
+			option{"sasl.username", sasl.Username},
+			option{"sasl.password", password},
+		)
+	}
+
+	config := map[string]interface{}{
+		"relay": map[string]interface{}{
+			"mode":     "managed",
+			"upstream": "http://sentry-web-ui:9000/",
+			"host":     "0.0.0.0",
+			"port":     relayPort,
+		},
+		"logging": map[string]interface{}{
+			"level": "WARN",
+		},
+		"processing": map[string]interface{}{
+			"enabled":      true,
+			"kafka_config": kafka,
+			"redis":        redis.String(),
+		},
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return generatedHeader + string(data) + "\n", nil
+}
+
+// deployment for relay
+func (r *ReconcileSentry) deploymentForRelay() *appsv1.Deployment {
+	rl := r.sentry.Spec.Relay
+	replicas := int32(rl.Replicas)
+	labels := map[string]string{"app": relayName}
+	volumes, mounts, _ := kafkaClient(r.sentry.Spec.Kafka)
+	volumes = append(volumes, corev1.Volume{
+		Name: "relay-config",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: relayName,
+				Items: []corev1.KeyToPath{
+					{Key: relayConfigKey, Path: relayConfigKey},
+					{Key: relayCredentialsKey, Path: relayCredentialsKey},
+				},
+			},
+		},
+	})
+	mounts = append(mounts, corev1.VolumeMount{
+		Name:      "relay-config",
+		MountPath: relayConfigPath,
+		ReadOnly:  true,
+	})
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      relayName,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					// relay reads its configuration once
+					Annotations: map[string]string{
+						configHashAnnotation: r.relayConfigHash,
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image:           rl.Image,
+						Name:            relayName,
+						Args:            []string{"run"},
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Ports: []corev1.ContainerPort{
+							{
+								ContainerPort: relayPort,
+								Protocol:      "TCP",
+							},
+						},
+						LivenessProbe: &corev1.Probe{
+							InitialDelaySeconds: int32(5),
+							Handler: corev1.Handler{
+								HTTPGet: &corev1.HTTPGetAction{
+									Path: "/api/relay/healthcheck/live/",
+									Port: intstr.IntOrString{
+										IntVal: relayPort,
+									},
+									Scheme: "HTTP",
+								},
+							},
+							PeriodSeconds: int32(10),
+						},
+						VolumeMounts: mounts,
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, dep, r.scheme)
+	return dep
+}
+
+// service for relay
+func (r *ReconcileSentry) serviceForRelay() *corev1.Service {
+	labels := map[string]string{"app": relayName}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:    labels,
+			Name:      relayName,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:     "relay-http",
+					Port:     relayPort,
+					Protocol: "TCP",
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, svc, r.scheme)
+	return svc
+}
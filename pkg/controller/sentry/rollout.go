@@ -0,0 +1,150 @@
+package sentry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// returns the rollout configured for a deployment, nil when it keeps the
+// defaults
+func (r *ReconcileSentry) rolloutFor(name string) *v1alpha1.RolloutSpec {
+	rollouts := r.sentry.Spec.Rollouts
+	name = baseName(name)
+	switch {
+	case name == "sentry-web-ui":
+		return rollouts.Web
+	case name == "sentry-worker":
+		return rollouts.Worker
+	case name == cronName:
+		return rollouts.Cron
+	case name == "sentry-ingest-consumer", name == "sentry-post-process-forwarder":
+		return rollouts.Consumers
+	case strings.HasPrefix(name, "snuba-"):
+		return rollouts.Snuba
+	case name == relayName:
+		return rollouts.Relay
+	}
+	return nil
+}
+
+// applies the configured rollout to a deployment
+func (r *ReconcileSentry) applyRollout(dep *appsv1.Deployment) {
+	rs := r.rolloutFor(dep.Name)
+	if rs == nil {
+		return
+	}
+	spec := &dep.Spec
+	spec.MinReadySeconds = rs.MinReadySeconds
+	spec.ProgressDeadlineSeconds = rs.ProgressDeadlineSeconds
+	spec.RevisionHistoryLimit = rs.RevisionHistoryLimit
+
+	// the strategy of the cron is fixed, see deploymentForSentryCron
+	if baseName(dep.Name) == cronName {
+		return
+	}
+	switch appsv1.DeploymentStrategyType(rs.Strategy) {
+	case appsv1.RecreateDeploymentStrategyType:
+		spec.Strategy = appsv1.DeploymentStrategy{
+			Type: appsv1.RecreateDeploymentStrategyType,
+		}
+	default:
+		spec.Strategy = appsv1.DeploymentStrategy{
+			Type: appsv1.RollingUpdateDeploymentStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateDeployment{
+				MaxSurge:       rs.MaxSurge,
+				MaxUnavailable: rs.MaxUnavailable,
+			},
+		}
+	}
+}
+
+// validates a rollout, returning the problems found
+func validateRollout(component string, rs *v1alpha1.RolloutSpec) []string {
+	if rs == nil {
+		return nil
+	}
+	errors := []string{}
+	switch appsv1.DeploymentStrategyType(rs.Strategy) {
+	case "", appsv1.RollingUpdateDeploymentStrategyType:
+		if component == "cron" {
+			errors = append(errors, "the cron rollout strategy can only be Recreate")
+		}
+	case appsv1.RecreateDeploymentStrategyType:
+		if rs.MaxSurge != nil || rs.MaxUnavailable != nil {
+			errors = append(errors, fmt.Sprintf("the %s rollout sets maxSurge or maxUnavailable with the Recreate strategy", component))
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("unknown %s rollout strategy '%s'", component, rs.Strategy))
+	}
+	if component == "cron" && (rs.MaxSurge != nil || rs.MaxUnavailable != nil) {
+		errors = append(errors, "the cron rollout can't set maxSurge or maxUnavailable")
+	}
+	if rs.MinReadySeconds < 0 {
+		errors = append(errors, fmt.Sprintf("the %s rollout minReadySeconds can't be negative", component))
+	}
+	if d := rs.ProgressDeadlineSeconds; d != nil && *d <= rs.MinReadySeconds {
+		errors = append(errors, fmt.Sprintf("the %s rollout progressDeadlineSeconds must be greater than minReadySeconds", component))
+	}
+	if l := rs.RevisionHistoryLimit; l != nil && *l < 0 {
+		errors = append(errors, fmt.Sprintf("the %s rollout revisionHistoryLimit can't be negative", component))
+	}
+	return errors
+}
+
+// validates the rollout of a statefulset, which only replaces its pods one at
+// a time and keeps no progress deadline
+func validateStatefulSetRollout(component string, rs *v1alpha1.RolloutSpec) []string {
+	if rs == nil {
+		return nil
+	}
+	errors := []string{}
+	if rs.Strategy != "" && appsv1.DeploymentStrategyType(rs.Strategy) != appsv1.RollingUpdateDeploymentStrategyType {
+		errors = append(errors, fmt.Sprintf("the %s rollout strategy can only be RollingUpdate", component))
+	}
+	if rs.MaxSurge != nil || rs.MaxUnavailable != nil || rs.MinReadySeconds != 0 || rs.ProgressDeadlineSeconds != nil {
+		errors = append(errors, fmt.Sprintf("the %s rollout can only set revisionHistoryLimit", component))
+	}
+	if l := rs.RevisionHistoryLimit; l != nil && *l < 0 {
+		errors = append(errors, fmt.Sprintf("the %s rollout revisionHistoryLimit can't be negative", component))
+	}
+	return errors
+}
+
+// returns whether the rollout of a deployment exceeded its progress deadline
+func rolloutStalled(dep *appsv1.Deployment) bool {
+	for _, cond := range dep.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing {
+			return cond.Status == corev1.ConditionFalse && cond.Reason == "ProgressDeadlineExceeded"
+		}
+	}
+	return false
+}
+
+// records the stalled rollouts in the status, warning about the ones that
+// just stalled
+func (r *ReconcileSentry) reportRollouts(stalled []string) {
+	status := &r.sentry.Status
+	sort.Strings(stalled)
+	known := map[string]bool{}
+	for _, name := range status.StalledRollouts {
+		known[name] = true
+	}
+	for _, name := range stalled {
+		if !known[name] {
+			r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "RolloutStalled", "The rollout of deployment %s exceeded its progress deadline", name)
+		}
+	}
+	status.StalledRollouts = stalled
+
+	if len(stalled) > 0 {
+		status.SetCondition(v1alpha1.ConditionRolloutsProgressing, corev1.ConditionFalse, "ProgressDeadlineExceeded",
+			fmt.Sprintf("the rollout of %s exceeded its progress deadline", strings.Join(stalled, ", ")))
+		return
+	}
+	status.SetCondition(v1alpha1.ConditionRolloutsProgressing, corev1.ConditionTrue, "Progressing", "every rollout is within its progress deadline")
+}
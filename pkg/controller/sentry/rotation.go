@@ -0,0 +1,144 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// pod template annotation holding the rotation the pod's key comes from
+	secretKeyAnnotation  = "sentry.redhat.com/secret-key-rotation"
+	previousSecretKeyKey = "SENTRY_SECRET_KEY_PREVIOUS"
+)
+
+// the order the processes pick up a new secret key in, the web goes last so
+// the links signed by the workers in between still work for the user
+var secretKeyRolloutOrder = []string{"sentry-worker", "sentry-cron", "sentry-web-ui"}
+
+// returns whether the secret key is the one generated by the operator
+func (r *ReconcileSentry) generatedSecretKey() bool {
+	sel := r.sentry.Spec.SentrySecretKeySecret
+	return sel != nil && sel.Name == generatedSecretName(r.sentry)
+}
+
+// replaces the generated secret key when the rotate annotation changed,
+// keeping the previous one around as fallback
+func (r *ReconcileSentry) rotateSecretKey() error {
+	requested := r.sentry.Annotations[v1alpha1.RotateSecretKeyAnnotation]
+	rotation := r.sentry.Status.SecretKeyRotation
+	if requested == "" || (rotation != nil && rotation.Requested == requested) {
+		return nil
+	}
+
+	if !r.generatedSecretKey() {
+		message := fmt.Sprintf("the secret key is read from secret '%s', replace it there and restart the sentry pods", r.sentry.Spec.SentrySecretKeySecret.Name)
+		r.recorder.Event(r.sentry, corev1.EventTypeWarning, "SecretKeyRotationSkipped", message)
+		r.sentry.Status.SecretKeyRotation = &v1alpha1.SecretKeyRotationStatus{
+			Requested: requested,
+			Phase:     "Skipped",
+			Message:   message,
+		}
+		return nil
+	}
+
+	sel := r.sentry.Spec.SentrySecretKeySecret
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: sel.Name, Namespace: r.sentry.Namespace}, secret)
+	if err != nil {
+		r.logger.Error(err, "Failed to get Secret.", "Secret.Name", sel.Name)
+		return err
+	}
+	key, err := randomString(50, secretKeyChars)
+	if err != nil {
+		return err
+	}
+	secret.Data[previousSecretKeyKey] = secret.Data[sel.Key]
+	secret.Data[sel.Key] = []byte(key)
+	r.logger.Info("Rotating the secret key.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+	if err := r.client.Update(context.TODO(), secret); err != nil {
+		r.logger.Error(err, "Failed to update Secret.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		return err
+	}
+
+	now := metav1.Now()
+	r.recorder.Eventf(r.sentry, corev1.EventTypeNormal, "SecretKeyRotated", "Generated a new secret key into secret %s, rolling the sentry processes", secret.Name)
+	r.sentry.Status.SecretKeyRotation = &v1alpha1.SecretKeyRotationStatus{
+		Requested:    requested,
+		RotationTime: &now,
+		Phase:        "Rolling",
+		Message:      "waiting for the sentry processes to restart with the new key",
+	}
+	// recorded right away, rotating twice would lose the previous key
+	return r.updateStatus("RotatingSecretKey")
+}
+
+// returns the rotation the pods of the given process should be on, the
+// processes move to a new rotation one at a time
+func (r *ReconcileSentry) secretKeyRotationFor(name string) string {
+	if value, ok := r.secretKeyRollout[name]; ok {
+		return value
+	}
+	if rotation := r.sentry.Status.SecretKeyRotation; rotation != nil && rotation.RotationTime != nil {
+		return rotation.Requested
+	}
+	return ""
+}
+
+// decides which processes move to the latest rotation in this reconcile:
+// the first one in order that hasn't finished rolling does, the ones after
+// it stay where they are; returns whether the rollout is still going
+func (r *ReconcileSentry) planSecretKeyRollout() (bool, error) {
+	r.secretKeyRollout = map[string]string{}
+	rotation := r.sentry.Status.SecretKeyRotation
+	if rotation == nil || rotation.Phase != "Rolling" {
+		return false, nil
+	}
+
+	rolling := false
+	for _, name := range secretKeyRolloutOrder {
+		dep := &appsv1.Deployment{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: coloredName(name, r.activeColor()), Namespace: r.sentry.Namespace}, dep)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			r.logger.Error(err, "Failed to get Deployment.", "Deployment.Name", name)
+			return false, err
+		}
+		current := dep.Spec.Template.Annotations[secretKeyAnnotation]
+		if rolling {
+			r.secretKeyRollout[name] = current
+			continue
+		}
+		if current != rotation.Requested || !RolledOut(dep) {
+			rolling = true
+			rotation.Message = fmt.Sprintf("waiting for %s to restart with the new key", name)
+		}
+	}
+
+	if !rolling {
+		rotation.Phase = "Completed"
+		rotation.Message = "every sentry process runs with the new key"
+	}
+	return rolling, nil
+}
+
+// RolledOut returns whether every replica of a deployment runs its current
+// template
+func RolledOut(dep *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+	return dep.Status.ObservedGeneration >= dep.Generation &&
+		dep.Status.UpdatedReplicas == replicas &&
+		dep.Status.AvailableReplicas == replicas &&
+		dep.Status.Replicas == replicas
+}
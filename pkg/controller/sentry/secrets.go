@@ -0,0 +1,154 @@
+package sentry
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// the characters sentry config generate-secret-key picks from
+	secretKeyChars = "abcdefghijklmnopqrstuvwxyz0123456789!@#%^&*(-_=+)"
+	passwordChars  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// returns the name of the secret holding the credentials generated for s
+func generatedSecretName(s *v1alpha1.Sentry) string {
+	return s.Name + "-generated"
+}
+
+// returns n characters picked at random from chars
+func randomString(n int, chars string) (string, error) {
+	max := big.NewInt(int64(len(chars)))
+	b := make([]byte, n)
+	for i := range b {
+		j, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = chars[j.Int64()]
+	}
+	return string(b), nil
+}
+
+// returns whether the selected secret and key exist
+func (r *ReconcileSentry) hasSecretKey(sel *corev1.SecretKeySelector) (bool, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: sel.Name, Namespace: r.sentry.Namespace}, secret)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	_, ok := secret.Data[sel.Key]
+	return ok, nil
+}
+
+// generates the credentials nobody supplied into a secret owned by the
+// instance and points their selectors at it; values are generated once and
+// kept from then on
+func (r *ReconcileSentry) generateSecrets() error {
+	spec := &r.sentry.Spec
+
+	superUserEmail := spec.Config.AdminEmail
+	if superUserEmail == "" {
+		superUserEmail = "admin@localhost"
+	}
+	type generated struct {
+		sel      **corev1.SecretKeySelector
+		key      string
+		generate func() (string, error)
+	}
+	candidates := []generated{
+		{&spec.SentrySecretKeySecret, spec.SentrySecretKeyKey, func() (string, error) { return randomString(50, secretKeyChars) }},
+		{&spec.SentrySuperUserEmailSecret, spec.SentrySuperUserEmailKey, func() (string, error) { return superUserEmail, nil }},
+		{&spec.SentrySuperUserPasswordSecret, spec.SentrySuperUserPasswordKey, func() (string, error) { return randomString(32, passwordChars) }},
+	}
+
+	// a value is supplied when its own selector is set, or when the sentry
+	// secret it defaults to has it
+	missing := []generated{}
+	for _, c := range candidates {
+		sel := *c.sel
+		if sel != nil && sel.Name != spec.SentrySecret {
+			continue
+		}
+		if sel != nil {
+			found, err := r.hasSecretKey(sel)
+			if err != nil {
+				return err
+			}
+			if found {
+				continue
+			}
+		}
+		missing = append(missing, c)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	name := generatedSecretName(r.sentry)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: r.sentry.Namespace}, secret)
+	exists := err == nil
+	if err != nil && !errors.IsNotFound(err) {
+		r.logger.Error(err, "Failed to get Secret.", "Secret.Name", name)
+		return err
+	}
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: r.sentry.Namespace,
+				Labels:    map[string]string{"app": "sentry"},
+			},
+		}
+		controllerutil.SetControllerReference(r.sentry, secret, r.scheme)
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+
+	changed := []string{}
+	for _, c := range missing {
+		if _, ok := secret.Data[c.key]; !ok {
+			value, err := c.generate()
+			if err != nil {
+				return err
+			}
+			secret.Data[c.key] = []byte(value)
+			changed = append(changed, c.key)
+		}
+		*c.sel = &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			Key:                  c.key,
+		}
+	}
+
+	if !exists {
+		r.logger.Info("Creating a new Secret.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.client.Create(context.TODO(), secret); err != nil {
+			r.logger.Error(err, "Failed to create new Secret.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return err
+		}
+	} else if len(changed) > 0 {
+		r.logger.Info("Secret already exists, adding the missing keys", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name, "Keys", changed)
+		if err := r.client.Update(context.TODO(), secret); err != nil {
+			r.logger.Error(err, "Failed to update Secret.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return err
+		}
+	}
+	if len(changed) > 0 {
+		r.recorder.Eventf(r.sentry, corev1.EventTypeNormal, "GeneratedSecrets", "Generated %v into secret %s", changed, name)
+	}
+	return nil
+}
@@ -16,7 +16,8 @@ func (r *ReconcileSentry) serviceForSentryWebUI() *corev1.Service {
 			Namespace: r.sentry.Namespace,
 		},
 		Spec: corev1.ServiceSpec{
-			Selector: labels,
+			// the web pods of the active set
+			Selector: map[string]string{"app": coloredName(name, r.activeColor())},
 			Ports: []corev1.ServicePort{
 				{
 					Name:     "sentry-http",
@@ -0,0 +1,351 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	snubaAPIName          = "snuba-api"
+	snubaAPIPort          = 1218
+	snubaBootstrapJobName = "snuba-bootstrap"
+)
+
+// a snuba process running from its own deployment
+type snubaComponent struct {
+	name string
+	args []string
+	// consumers scale with ConsumerReplicas, the others run alone
+	consumer bool
+}
+
+// the snuba processes besides the api, as run by the self-hosted sentry
+var snubaComponents = []snubaComponent{
+	{"snuba-consumer", []string{"consumer", "--storage", "events", "--auto-offset-reset=latest", "--max-batch-time-ms", "750"}, true},
+	{"snuba-outcomes-consumer", []string{"consumer", "--storage", "outcomes_raw", "--auto-offset-reset=earliest", "--max-batch-time-ms", "750"}, true},
+	{"snuba-sessions-consumer", []string{"consumer", "--storage", "sessions_raw", "--auto-offset-reset=latest", "--max-batch-time-ms", "750"}, true},
+	{"snuba-transactions-consumer", []string{"consumer", "--storage", "transactions", "--consumer-group", "transactions_group", "--auto-offset-reset=latest", "--max-batch-time-ms", "750"}, true},
+	{"snuba-replacer", []string{"replacer", "--storage", "events", "--auto-offset-reset=latest", "--max-batch-size", "3"}, false},
+	{"snuba-subscription-consumer-events", []string{
+		"subscriptions",
+		"--auto-offset-reset=latest",
+		"--consumer-group=snuba-events-subscriptions-consumers",
+		"--topic=events",
+		"--result-topic=events-subscription-results",
+		"--dataset=events",
+		"--commit-log-topic=snuba-commit-log",
+		"--commit-log-group=snuba-consumers",
+		"--delay-seconds=60",
+		"--schedule-ttl=60",
+	}, false},
+	{"snuba-subscription-consumer-transactions", []string{
+		"subscriptions",
+		"--auto-offset-reset=latest",
+		"--consumer-group=snuba-transactions-subscriptions-consumers",
+		"--topic=events",
+		"--result-topic=transactions-subscription-results",
+		"--dataset=transactions",
+		"--commit-log-topic=snuba-commit-log",
+		"--commit-log-group=transactions_group",
+		"--delay-seconds=60",
+		"--schedule-ttl=60",
+	}, false},
+}
+
+// returns the url sentry reaches the snuba api at
+func snubaURL() string {
+	return fmt.Sprintf("http://%s:%d", snubaAPIName, snubaAPIPort)
+}
+
+// returns a common pod template for the snuba jobs/deployments
+func (r *ReconcileSentry) getSnubaPodTemplate(opts templateOpts) corev1.PodTemplateSpec {
+	spec := r.sentry.Spec
+	sn := spec.Snuba
+	labels := map[string]string{"app": opts.Name}
+	env := []corev1.EnvVar{
+		{
+			Name:  "SNUBA_SETTINGS",
+			Value: snubaSettingsPath,
+		},
+		{
+			Name:  "CLICKHOUSE_HOST",
+			Value: clickHouseHost(&sn.ClickHouse),
+		},
+		{
+			Name:  "CLICKHOUSE_PORT",
+			Value: fmt.Sprintf("%d", sn.ClickHouse.Port),
+		},
+		{
+			Name:  "CLICKHOUSE_HTTP_PORT",
+			Value: fmt.Sprintf("%d", sn.ClickHouse.HTTPPort),
+		},
+		{
+			Name:  "CLICKHOUSE_DATABASE",
+			Value: sn.ClickHouse.Database,
+		},
+		{
+			Name:  "CLICKHOUSE_USER",
+			Value: sn.ClickHouse.User,
+		},
+		{
+			Name:  "DEFAULT_BROKERS",
+			Value: strings.Join(spec.Kafka.BootstrapServers, ","),
+		},
+		{
+			Name:  "REDIS_HOST",
+			Value: spec.RedisHost,
+		},
+		{
+			Name:  "REDIS_PORT",
+			Value: fmt.Sprintf("%d", spec.RedisPort),
+		},
+		{
+			Name:  "REDIS_DB",
+			Value: spec.RedisDB,
+		},
+	}
+	if sel := spec.RedisPasswordSecret; sel != nil {
+		env = append(env, secretEnv("REDIS_PASSWORD", sel))
+	}
+	if sel := sn.ClickHouse.PasswordSecret; sel != nil {
+		env = append(env, secretEnv("CLICKHOUSE_PASSWORD", sel))
+	}
+	volumes, mounts, kafkaEnv := kafkaClient(spec.Kafka)
+	env = append(env, kafkaEnv...)
+	volumes = append(volumes, corev1.Volume{
+		Name: "sentry-config",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: configMapName,
+				},
+			},
+		},
+	})
+	mounts = append(mounts, corev1.VolumeMount{
+		Name:      "sentry-config",
+		MountPath: snubaSettingsPath,
+		SubPath:   snubaSettingsKey,
+		ReadOnly:  true,
+	})
+	if len(opts.ExtraEnv) > 0 {
+		env = append(env, opts.ExtraEnv...)
+	}
+	restartPolicy := corev1.RestartPolicyAlways
+	if opts.RestartPolicy != nil {
+		restartPolicy = *opts.RestartPolicy
+	}
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labels,
+			Annotations: map[string]string{
+				configHashAnnotation: r.configHash,
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image:           sn.Image,
+				Name:            opts.Name,
+				Args:            opts.Args,
+				Env:             env,
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				Ports:           opts.ContainerPorts,
+				LivenessProbe:   opts.LivenessProbe,
+				Resources:       opts.Resources,
+				VolumeMounts:    mounts,
+			}},
+			Volumes:       volumes,
+			RestartPolicy: restartPolicy,
+		},
+	}
+}
+
+// job creating the ClickHouse tables and running the snuba migrations, the
+// kafka topics are left to the operator
+func (r *ReconcileSentry) jobForSnubaBootstrap() *batchv1.Job {
+	name := snubaBootstrapJobName
+	restartPolicy := corev1.RestartPolicyOnFailure
+	opts := templateOpts{
+		Name: name,
+		Args: []string{
+			"bootstrap",
+			"--no-kafka",
+			"--force",
+		},
+		RestartPolicy: &restartPolicy,
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			Template: r.getSnubaPodTemplate(opts),
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, job, r.scheme)
+	return job
+}
+
+// runs the snuba migrations once per image; returns the phase to report
+// until they're done
+func (r *ReconcileSentry) migrateSnuba() (string, error) {
+	status := &r.sentry.Status
+	image := r.sentry.Spec.Snuba.Image
+
+	job, state, err := r.getJobState(snubaBootstrapJobName)
+	if err != nil {
+		return "", err
+	}
+	if job != nil && jobImage(job) != image {
+		// left over by the previous image, the job watch brings us back
+		// once it's gone
+		return "UpgradingSnuba", r.deleteJob(job)
+	}
+
+	switch state {
+	case JobMissing:
+		job = r.jobForSnubaBootstrap()
+		r.logger.Info("Creating a new Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.client.Create(context.TODO(), job); err != nil {
+			r.logger.Error(err, "Failed to create Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return "", err
+		}
+		return "UpgradingSnuba", nil
+	case JobRunning:
+		r.logger.Info("Waiting for job to complete.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		return "UpgradingSnuba", nil
+	case JobFailed:
+		r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "SnubaMigrationFailed", "Migrations of %s failed, see the logs of job %s", image, snubaBootstrapJobName)
+		return "SnubaUpgradeFailed", nil
+	}
+
+	if status.SnubaMigratedImage != image {
+		r.recorder.Eventf(r.sentry, corev1.EventTypeNormal, "SnubaMigrated", "Migrations of %s completed", image)
+		status.SnubaMigratedImage = image
+	}
+	return "", nil
+}
+
+// deployment for the snuba api
+func (r *ReconcileSentry) deploymentForSnubaAPI() *appsv1.Deployment {
+	name := snubaAPIName
+	replicas := int32(r.sentry.Spec.Snuba.APIReplicas)
+	opts := templateOpts{
+		Name: name,
+		Args: []string{
+			"api",
+		},
+		ContainerPorts: []corev1.ContainerPort{
+			{
+				ContainerPort: snubaAPIPort,
+				Protocol:      "TCP",
+			},
+		},
+		LivenessProbe: &corev1.Probe{
+			InitialDelaySeconds: int32(10),
+			Handler: corev1.Handler{
+				HTTPGet: &corev1.HTTPGetAction{
+					Path: "/health",
+					Port: intstr.IntOrString{
+						IntVal: snubaAPIPort,
+					},
+					Scheme: "HTTP",
+				},
+			},
+			PeriodSeconds: int32(10),
+		},
+	}
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			Template: r.getSnubaPodTemplate(opts),
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, dep, r.scheme)
+	return dep
+}
+
+// deployment for one of the snuba consumers
+func (r *ReconcileSentry) deploymentForSnubaComponent(c snubaComponent) *appsv1.Deployment {
+	replicas := int32(1)
+	if c.consumer {
+		replicas = int32(r.sentry.Spec.Snuba.ConsumerReplicas)
+	}
+	opts := templateOpts{
+		Name: c.name,
+		Args: c.args,
+	}
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.name,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": c.name},
+			},
+			Template: r.getSnubaPodTemplate(opts),
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, dep, r.scheme)
+	return dep
+}
+
+// returns the builders of every snuba deployment
+func (r *ReconcileSentry) snubaDeployments() []func() *appsv1.Deployment {
+	deployments := []func() *appsv1.Deployment{r.deploymentForSnubaAPI}
+	for _, c := range snubaComponents {
+		c := c
+		deployments = append(deployments, func() *appsv1.Deployment {
+			return r.deploymentForSnubaComponent(c)
+		})
+	}
+	return deployments
+}
+
+// service for the snuba api
+func (r *ReconcileSentry) serviceForSnubaAPI() *corev1.Service {
+	labels := map[string]string{"app": snubaAPIName}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:    labels,
+			Name:      snubaAPIName,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:     "snuba-http",
+					Port:     snubaAPIPort,
+					Protocol: "TCP",
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, svc, r.scheme)
+	return svc
+}
@@ -0,0 +1,181 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const superUserJobName = "sentry-createuser"
+
+// creates the superuser or brings an existing one up to date; the password
+// is only set when it changed so the sessions of the superuser survive
+const superUserScript = `
+import os
+import sys
+
+from django.conf import settings
+from sentry.models import Organization, OrganizationMember, User
+
+email = os.environ['SENTRY_SU_EMAIL']
+password = os.environ['SENTRY_SU_PASSWORD']
+
+user = User.objects.filter(username=email).first()
+created = user is None
+if created:
+    user = User(username=email)
+
+user.email = email
+user.is_active = True
+user.is_staff = True
+user.is_superuser = True
+if created or not user.check_password(password):
+    user.set_password(password)
+user.save()
+
+if settings.SENTRY_SINGLE_ORGANIZATION:
+    OrganizationMember.objects.get_or_create(
+        organization=Organization.get_default(),
+        user=user,
+        defaults={'role': 'owner'},
+    )
+
+sys.stdout.write('%s superuser %s\n' % ('Created' if created else 'Updated', email))
+`
+
+// job creating or updating the superuser, the hash annotation tracks the
+// credentials it was run with
+func (r *ReconcileSentry) jobForSentrySuperUser(hash string) *batchv1.Job {
+	name := superUserJobName
+	restartPolicy := corev1.RestartPolicyNever
+	backoffLimit := int32(3)
+	opts := templateOpts{
+		Name: name,
+		Args: []string{
+			"exec",
+			"-c",
+			superUserScript,
+		},
+		ExtraEnv: []corev1.EnvVar{
+			secretEnv("SENTRY_SU_EMAIL", r.sentry.Spec.SentrySuperUserEmailSecret),
+			secretEnv("SENTRY_SU_PASSWORD", r.sentry.Spec.SentrySuperUserPasswordSecret),
+		},
+		RestartPolicy: &restartPolicy,
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.sentry.Namespace,
+			Annotations: map[string]string{
+				hashAnnotation: hash,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template:     r.getCommonPodTemplate(opts),
+			BackoffLimit: &backoffLimit,
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, job, r.scheme)
+	return job
+}
+
+// returns a hash of the superuser credentials, keyed with the sentry secret
+// key so the annotation doesn't give the password away
+func (r *ReconcileSentry) superUserHash() (string, error) {
+	values := []string{}
+	for _, sel := range []*corev1.SecretKeySelector{
+		r.sentry.Spec.SentrySecretKeySecret,
+		r.sentry.Spec.SentrySuperUserEmailSecret,
+		r.sentry.Spec.SentrySuperUserPasswordSecret,
+	} {
+		value, err := r.readSecretKey(sel)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, value)
+	}
+	return hashOf(values), nil
+}
+
+// runs the superuser job again whenever the credentials change and reports
+// how it went
+func (r *ReconcileSentry) superUser() error {
+	status := &r.sentry.Status
+
+	hash, err := r.superUserHash()
+	if err != nil {
+		return err
+	}
+	job, state, err := r.getJobState(superUserJobName)
+	if err != nil {
+		return err
+	}
+	if job != nil && job.Annotations[hashAnnotation] != hash {
+		// the job watch brings us back once it's gone
+		status.SetCondition(v1alpha1.ConditionSuperUserReady, corev1.ConditionUnknown, "Updating", "the superuser credentials changed")
+		return r.deleteJob(job)
+	}
+
+	switch state {
+	case JobMissing:
+		job = r.jobForSentrySuperUser(hash)
+		r.logger.Info("Creating a new Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.client.Create(context.TODO(), job); err != nil {
+			r.logger.Error(err, "Failed to create Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return err
+		}
+		status.SetCondition(v1alpha1.ConditionSuperUserReady, corev1.ConditionUnknown, "Updating", "waiting for the superuser job to finish")
+	case JobComplete:
+		status.SetCondition(v1alpha1.ConditionSuperUserReady, corev1.ConditionTrue, "Ready", "the superuser matches the credentials in the secret")
+	case JobFailed:
+		if c := status.GetCondition(v1alpha1.ConditionSuperUserReady); c == nil || c.Status != corev1.ConditionFalse {
+			r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "SuperUserFailed", "Creating or updating the superuser failed, see the logs of job %s", superUserJobName)
+		}
+		status.SetCondition(v1alpha1.ConditionSuperUserReady, corev1.ConditionFalse, "JobFailed",
+			fmt.Sprintf("see the logs of job %s, it runs again once the credentials change", superUserJobName))
+	}
+	return nil
+}
+
+// returns a mapper enqueueing the instances whose superuser credentials may be
+// read from the secret, jobs don't notice when a secret changes
+func superUserSecretMapper(c client.Client) handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		sentries := &v1alpha1.SentryList{}
+		if err := c.List(context.TODO(), client.InNamespace(obj.Meta.GetNamespace()), sentries); err != nil {
+			log.Error(err, "Failed to list Sentries.", "Namespace", obj.Meta.GetNamespace())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for i := range sentries.Items {
+			s := &sentries.Items[i]
+			s.SetDefaults()
+			names := map[string]bool{generatedSecretName(s): true}
+			for _, sel := range []*corev1.SecretKeySelector{
+				s.Spec.SentrySecretKeySecret,
+				s.Spec.SentrySuperUserEmailSecret,
+				s.Spec.SentrySuperUserPasswordSecret,
+			} {
+				if sel != nil {
+					names[sel.Name] = true
+				}
+			}
+			if names[obj.Meta.GetName()] {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: s.Name, Namespace: s.Namespace},
+				})
+			}
+		}
+		return requests
+	}
+}
@@ -0,0 +1,202 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	symbolicatorName       = "sentry-symbolicator"
+	symbolicatorPort       = 3021
+	symbolicatorConfigKey  = "symbolicator.yml"
+	symbolicatorConfigPath = "/etc/symbolicator/config.yml"
+	symbolicatorCachePath  = "/data"
+)
+
+// the symbolicator configuration, the sources are passed by sentry with each
+// request so only the server itself is set up here
+var symbolicatorConfig = generatedHeader + fmt.Sprintf(`bind: "0.0.0.0:%d"
+cache_dir: "%s"
+logging:
+  level: "warn"
+metrics:
+  statsd: null
+`, symbolicatorPort, symbolicatorCachePath)
+
+// returns the address sentry reaches symbolicator at
+func symbolicatorURL() string {
+	return fmt.Sprintf("http://%s:%d", symbolicatorName, symbolicatorPort)
+}
+
+// statefulset for symbolicator, each replica keeps its cache on its own claim
+func (r *ReconcileSentry) statefulSetForSymbolicator() *appsv1.StatefulSet {
+	sy := r.sentry.Spec.Symbolicator
+	replicas := int32(sy.Replicas)
+	labels := map[string]string{"app": symbolicatorName}
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      symbolicatorName,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: symbolicatorName,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			// the replicas don't depend on each other
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					Annotations: map[string]string{
+						configHashAnnotation: hashOf(symbolicatorConfig),
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image:           sy.Image,
+						Name:            symbolicatorName,
+						Args:            []string{"run", "-c", symbolicatorConfigPath},
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Ports: []corev1.ContainerPort{
+							{
+								ContainerPort: symbolicatorPort,
+								Protocol:      "TCP",
+							},
+						},
+						Resources: sy.Resources,
+						ReadinessProbe: &corev1.Probe{
+							InitialDelaySeconds: int32(5),
+							Handler: corev1.Handler{
+								HTTPGet: &corev1.HTTPGetAction{
+									Path: "/healthcheck",
+									Port: intstr.IntOrString{
+										IntVal: symbolicatorPort,
+									},
+									Scheme: "HTTP",
+								},
+							},
+							PeriodSeconds: int32(10),
+						},
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      "cache",
+								MountPath: symbolicatorCachePath,
+							},
+							{
+								Name:      "sentry-config",
+								MountPath: symbolicatorConfigPath,
+								SubPath:   symbolicatorConfigKey,
+								ReadOnly:  true,
+							},
+						},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "sentry-config",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: configMapName,
+								},
+							},
+						},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "cache",
+					Labels: labels,
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					StorageClassName: sy.StorageClassName,
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: resource.MustParse(sy.CacheSize),
+						},
+					},
+				},
+			}},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, sts, r.scheme)
+	return sts
+}
+
+// service for symbolicator
+func (r *ReconcileSentry) serviceForSymbolicator() *corev1.Service {
+	labels := map[string]string{"app": symbolicatorName}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:    labels,
+			Name:      symbolicatorName,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:     "symbolicator-http",
+					Port:     symbolicatorPort,
+					Protocol: "TCP",
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, svc, r.scheme)
+	return svc
+}
+
+// creates or updates symbolicator, the claims of an existing statefulset
+// can't change so only its replicas and pod template are updated
+func (r *ReconcileSentry) reconcileSymbolicator() error {
+	sts := r.statefulSetForSymbolicator()
+	found := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		r.logger.Info("Creating a new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+		if err := r.client.Create(context.TODO(), sts); err != nil {
+			r.logger.Error(err, "Failed to create new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+			return err
+		}
+	} else if err != nil {
+		r.logger.Error(err, "Failed to get StatefulSet.", "StatefulSet.Name", sts.Name)
+		return err
+	} else {
+		r.logger.Info("StatefulSet already exists, updating to reconcile", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+		found.Spec.Replicas = sts.Spec.Replicas
+		found.Spec.Template = sts.Spec.Template
+		if err := r.client.Update(context.TODO(), found); err != nil {
+			r.logger.Error(err, "Failed to update StatefulSet.", "StatefulSet.Namespace", found.Namespace, "StatefulSet.Name", found.Name)
+			return err
+		}
+	}
+
+	svc := r.serviceForSymbolicator()
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, &corev1.Service{})
+	if err != nil && errors.IsNotFound(err) {
+		r.logger.Info("Creating a new Service.", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+		if err := r.client.Create(context.TODO(), svc); err != nil {
+			r.logger.Error(err, "Failed to create new Service.", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+			return err
+		}
+	} else if err != nil {
+		r.logger.Error(err, "Failed to get Service.", "Service.Name", svc.Name)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	upgradeFromAnnotation = "sentry.redhat.com/upgrade-from"
+	upgradeToAnnotation   = "sentry.redhat.com/upgrade-to"
+)
+
+// returns the image sentry runs, the previous one while a failed upgrade is
+// rolled back
+func (r *ReconcileSentry) runningImage() string {
+	status := r.sentry.Status
+	if status.FailedImage != "" && status.FailedImage == r.sentry.Spec.SentryImage && status.MigratedImage != "" {
+		return status.MigratedImage
+	}
+	return r.sentry.Spec.SentryImage
+}
+
+// returns the image a job runs
+func jobImage(job *batchv1.Job) string {
+	return job.Spec.Template.Spec.Containers[0].Image
+}
+
+// runs the migrations once per image, behind a backup when upgrading from a
+// previous image; returns the phase to report until they're done
+func (r *ReconcileSentry) migrate() (string, error) {
+	status := &r.sentry.Status
+
+	if status.FailedImage != "" && status.FailedImage != r.sentry.Spec.SentryImage {
+		status.FailedImage = ""
+		status.SetCondition(v1alpha1.ConditionRolledBack, corev1.ConditionFalse, "ImageChanged", "sentryImage changed since the rollback")
+	}
+	if status.FailedImage != "" {
+		phase, err := r.rollbackPhase()
+		if phase != "" || err != nil {
+			return phase, err
+		}
+	}
+
+	image := r.runningImage()
+	if r.blueGreenRollback(image) {
+		// the database stays on the schema of the newer image, the previous
+		// set only goes back to it when its code knows that schema
+		if status.MigratedImage != "" && status.MigratedImage != image {
+			return r.checkVersionSkew(image)
+		}
+		return "", nil
+	}
+	job, state, err := r.getJobState(UpgraderJobName)
+	if err != nil {
+		return "", err
+	}
+	if job != nil && state == JobComplete && status.MigratedImage == "" {
+		// migrated before the image was recorded
+		status.MigratedImage = jobImage(job)
+		status.MigratedVersion = ""
+	}
+	if job != nil && jobImage(job) != image {
+		// left over by the previous image, the job watch brings us back
+		// once it's gone
+		return "Upgrading", r.deleteJob(job)
+	}
+
+	switch state {
+	case JobMissing:
+		if status.MigratedImage != "" && status.MigratedImage != image {
+			// old code doesn't know a newer schema, and some upgrades
+			// need the migrations of a version in between
+			phase, err := r.checkVersionSkew(image)
+			if phase != "" || err != nil {
+				return phase, err
+			}
+		}
+		if status.MigratedImage != "" && status.MigratedImage != image && r.sentry.Spec.UpgradeBackup != nil {
+			phase, err := r.preUpgradeBackup(image)
+			if phase != "" || err != nil {
+				return phase, err
+			}
+		}
+		job = r.jobForSentryUpgrader()
+		r.logger.Info("Creating a new Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.client.Create(context.TODO(), job); err != nil {
+			r.logger.Error(err, "Failed to create Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return "", err
+		}
+		return "Upgrading", nil
+	case JobRunning:
+		r.logger.Info("Waiting for job to complete.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		return "Upgrading", nil
+	case JobFailed:
+		return r.migrationFailed(image)
+	}
+
+	if status.MigratedImage != image {
+		r.recorder.Eventf(r.sentry, corev1.EventTypeNormal, "Migrated", "Migrations of %s completed", image)
+		status.MigratedImage = image
+		status.MigratedVersion = versionFromTag(image)
+		if version, ok := status.ImageVersions[image]; ok && status.MigratedVersion == "" {
+			status.MigratedVersion = version
+		}
+	}
+	return "", nil
+}
+
+// makes sure a completed backup of the database exists before the migrations
+// of image run; returns the phase to report until it does
+func (r *ReconcileSentry) preUpgradeBackup(image string) (string, error) {
+	status := &r.sentry.Status
+
+	// one backup per migration, whatever else changes in the spec while it
+	// waits; the retention of the backups tells the dumps of these apart by
+	// their name
+	name := fmt.Sprintf("%s-pre-upgrade-%s", r.sentry.Name, hashOf([]string{status.MigratedImage, image}))
+	backup := &v1alpha1.SentryBackup{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: r.sentry.Namespace}, backup)
+	if err != nil && errors.IsNotFound(err) {
+		backup = r.backupForUpgrade(name, image)
+		r.logger.Info("Creating a new SentryBackup.", "SentryBackup.Namespace", backup.Namespace, "SentryBackup.Name", backup.Name)
+		if err := r.client.Create(context.TODO(), backup); err != nil && !errors.IsAlreadyExists(err) {
+			r.logger.Error(err, "Failed to create SentryBackup.", "SentryBackup.Namespace", backup.Namespace, "SentryBackup.Name", backup.Name)
+			return "", err
+		}
+		r.recorder.Eventf(r.sentry, corev1.EventTypeNormal, "BackingUp", "Backing up the database to %s before migrating to %s", backup.Name, image)
+		status.UpgradeBackup = backup.Name
+		return "BackingUp", nil
+	} else if err != nil {
+		return "", err
+	}
+	status.UpgradeBackup = backup.Name
+
+	switch backup.Status.Phase {
+	case v1alpha1.BackupCompleted:
+		return "", nil
+	case v1alpha1.BackupFailed:
+		// never migrate without a way back, deleting the backup tries again
+		r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "UpgradeBlocked", "Backup %s failed, not migrating to %s, delete it to try again: %s", backup.Name, image, backup.Status.Message)
+		return "UpgradeBlocked", nil
+	case v1alpha1.BackupPruned:
+		// the migration was attempted long ago, its dump is gone
+		r.logger.Info("Deleting SentryBackup.", "SentryBackup.Namespace", backup.Namespace, "SentryBackup.Name", backup.Name)
+		if err := r.client.Delete(context.TODO(), backup); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "Failed to delete SentryBackup.", "SentryBackup.Namespace", backup.Namespace, "SentryBackup.Name", backup.Name)
+			return "", err
+		}
+	}
+	return "BackingUp", nil
+}
+
+// IsUpgradeBackup returns whether b was taken before migrating to a new image
+func IsUpgradeBackup(b *v1alpha1.SentryBackup) bool {
+	_, ok := b.Annotations[upgradeToAnnotation]
+	return ok
+}
+
+// returns the backup taken before migrating to image
+func (r *ReconcileSentry) backupForUpgrade(name, image string) *v1alpha1.SentryBackup {
+	ub := r.sentry.Spec.UpgradeBackup
+	backup := &v1alpha1.SentryBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.sentry.Namespace,
+			Annotations: map[string]string{
+				upgradeFromAnnotation: r.sentry.Status.MigratedImage,
+				upgradeToAnnotation:   image,
+			},
+		},
+		Spec: v1alpha1.SentryBackupSpec{
+			Sentry:    r.sentry.Name,
+			Storage:   ub.Storage,
+			Prefix:    ub.Prefix,
+			Retention: ub.Retention,
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, backup, r.scheme)
+	return backup
+}
+
+// restores the pre-upgrade backup and pins the deployments to the previous
+// image when asked to, otherwise waits for a new sentryImage
+func (r *ReconcileSentry) migrationFailed(image string) (string, error) {
+	status := &r.sentry.Status
+	ub := r.sentry.Spec.UpgradeBackup
+
+	if ub == nil || !ub.RollbackOnFailure || status.MigratedImage == "" || status.MigratedImage == image || status.UpgradeBackup == "" {
+		r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "MigrationFailed", "Migrations of %s failed, see the logs of job %s", image, UpgraderJobName)
+		return "UpgradeFailed", nil
+	}
+
+	restore := r.restoreForRollback(image)
+	r.logger.Info("Creating a new SentryRestore.", "SentryRestore.Namespace", restore.Namespace, "SentryRestore.Name", restore.Name)
+	if err := r.client.Create(context.TODO(), restore); err != nil && !errors.IsAlreadyExists(err) {
+		r.logger.Error(err, "Failed to create SentryRestore.", "SentryRestore.Namespace", restore.Namespace, "SentryRestore.Name", restore.Name)
+		return "", err
+	}
+
+	message := fmt.Sprintf("migrations of %s failed, restoring backup %s and rolling back to %s", image, status.UpgradeBackup, status.MigratedImage)
+	r.recorder.Event(r.sentry, corev1.EventTypeWarning, "RollingBack", message)
+	status.FailedImage = image
+	status.SetCondition(v1alpha1.ConditionRolledBack, corev1.ConditionTrue, "MigrationFailed", message)
+	return "RollingBack", nil
+}
+
+// returns the restore rolling back the failed migrations of image
+func (r *ReconcileSentry) restoreForRollback(image string) *v1alpha1.SentryRestore {
+	restore := &v1alpha1.SentryRestore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      rollbackName(r.sentry),
+			Namespace: r.sentry.Namespace,
+			Annotations: map[string]string{
+				upgradeFromAnnotation: r.sentry.Status.MigratedImage,
+				upgradeToAnnotation:   image,
+			},
+		},
+		Spec: v1alpha1.SentryRestoreSpec{
+			Sentry: r.sentry.Name,
+			Backup: r.sentry.Status.UpgradeBackup,
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, restore, r.scheme)
+	return restore
+}
+
+// the rollback restores the backup taken before the upgrade, so there's one
+// rollback per backup
+func rollbackName(s *v1alpha1.Sentry) string {
+	return s.Status.UpgradeBackup + "-rollback"
+}
+
+// returns the phase to report while the rollback restore is underway
+func (r *ReconcileSentry) rollbackPhase() (string, error) {
+	if r.sentry.Status.UpgradeBackup == "" {
+		return "", nil
+	}
+	restore := &v1alpha1.SentryRestore{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: rollbackName(r.sentry), Namespace: r.sentry.Namespace}, restore)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+		if c := r.sentry.Status.GetCondition(v1alpha1.ConditionRolledBack); c != nil && c.Reason == "MigrationFailed" {
+			// it was just created and isn't in the cache yet
+			return "RollingBack", nil
+		}
+		return "", nil
+	}
+
+	switch restore.Status.Phase {
+	case v1alpha1.RestoreFailed:
+		if c := r.sentry.Status.GetCondition(v1alpha1.ConditionRolledBack); c != nil && c.Reason != "RestoreFailed" {
+			r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "RollbackFailed", "Restoring backup %s failed: %s", restore.Spec.Backup, restore.Status.Message)
+		}
+		r.sentry.Status.SetCondition(v1alpha1.ConditionRolledBack, corev1.ConditionFalse, "RestoreFailed", restore.Status.Message)
+		return "RollbackFailed", nil
+	case v1alpha1.RestoreCompleted:
+		r.sentry.Status.SetCondition(v1alpha1.ConditionRolledBack, corev1.ConditionTrue, "Restored",
+			fmt.Sprintf("migrations of %s failed, restored backup %s and rolled back to %s", r.sentry.Status.FailedImage, restore.Spec.Backup, r.sentry.Status.MigratedImage))
+		return "", nil
+	case v1alpha1.RestoreUpgrading:
+		// the restore waits for us to run the migrations of the previous image
+		return "", nil
+	}
+	return "RollingBack", nil
+}
@@ -0,0 +1,235 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const versionJobName = "sentry-version"
+
+// the versions an upgrade has to stop at, their migrations squash or drop
+// the ones of the versions before; kept in sync with the hard stops of the
+// self-hosted releases, https://develop.sentry.dev/self-hosted/releases/
+var upgradeHardStops = []string{"9.1.2", "21.5.0", "21.6.3", "23.6.2", "23.11.0", "24.8.0", "25.5.1"}
+
+// matches the version at the start of a tag, e.g. 9.1.2 or 20.6.0-py3
+var tagVersion = regexp.MustCompile(`^v?([0-9]+\.[0-9]+(\.[0-9]+)?)`)
+
+// matches the output of sentry --version
+var cliVersion = regexp.MustCompile(`version\s+v?([0-9]+\.[0-9]+(\.[0-9]+)?)`)
+
+// returns the version in the tag of an image, empty for the tags that don't
+// name one such as latest, or when the image is pinned by digest
+func versionFromTag(image string) string {
+	if strings.Contains(image, "@") {
+		return ""
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	m := tagVersion.FindStringSubmatch(image[i+1:])
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// compares two versions, returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < 3; i++ {
+		x, y := 0, 0
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// returns why migrating from one version to another isn't supported, empty
+// when it is
+func versionSkew(from, to string) string {
+	if compareVersions(to, from) < 0 {
+		return fmt.Sprintf("%s is older than the migrated version %s, its code doesn't know the current schema", to, from)
+	}
+	for _, stop := range upgradeHardStops {
+		if compareVersions(from, stop) < 0 && compareVersions(stop, to) < 0 {
+			return fmt.Sprintf("upgrading from %s to %s skips %s, upgrade to %s first", from, to, stop, stop)
+		}
+	}
+	return ""
+}
+
+// job printing the sentry version of an image
+func (r *ReconcileSentry) jobForSentryVersion(image string) *batchv1.Job {
+	name := versionJobName
+	zero := int32(0)
+	deadline := int64(120)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.sentry.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &zero,
+			ActiveDeadlineSeconds: &deadline,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": name},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:            name,
+						Image:           image,
+						ImagePullPolicy: corev1.PullAlways,
+						Command: []string{
+							"/bin/sh",
+							"-c",
+							"sentry --version > /dev/termination-log",
+						},
+					}},
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(r.sentry, job, r.scheme)
+	return job
+}
+
+// returns the sentry version of an image, read from its tag or from the
+// output of a job running it; empty with the phase to report until it's
+// known, and empty without a phase when it can't be found
+func (r *ReconcileSentry) imageVersion(image string) (string, string, error) {
+	status := &r.sentry.Status
+	if version := versionFromTag(image); version != "" {
+		return version, "", nil
+	}
+	if version, ok := status.ImageVersions[image]; ok {
+		return version, "", nil
+	}
+
+	job, state, err := r.getJobState(versionJobName)
+	if err != nil {
+		return "", "", err
+	}
+	if job != nil && jobImage(job) != image {
+		// left over by another image, the job watch brings us back once
+		// it's gone
+		return "", "InspectingVersion", r.deleteJob(job)
+	}
+
+	version := ""
+	switch state {
+	case JobMissing:
+		job = r.jobForSentryVersion(image)
+		r.logger.Info("Creating a new Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.client.Create(context.TODO(), job); err != nil {
+			r.logger.Error(err, "Failed to create Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return "", "", err
+		}
+		return "", "InspectingVersion", nil
+	case JobRunning:
+		return "", "InspectingVersion", nil
+	case JobComplete:
+		if m := cliVersion.FindStringSubmatch(r.jobTerminationMessage(versionJobName)); m != nil {
+			version = m[1]
+		}
+	}
+
+	// an image whose version can't be found is remembered as such, it's
+	// only inspected again once another image was
+	if status.ImageVersions == nil {
+		status.ImageVersions = map[string]string{}
+	}
+	status.ImageVersions[image] = version
+	return version, "", r.deleteJob(job)
+}
+
+// returns whether image can run on the schema of the migrated version: the
+// reason to report, Compatible when it can, and a message giving the versions
+// or why it can't; returns the phase to report instead until the versions are
+// known
+func (r *ReconcileSentry) versionProblem(image string) (string, string, string, error) {
+	status := &r.sentry.Status
+
+	to, phase, err := r.imageVersion(image)
+	if phase != "" || err != nil {
+		return "", "", phase, err
+	}
+	from := status.MigratedVersion
+	if from == "" {
+		from, phase, err = r.imageVersion(status.MigratedImage)
+		if phase != "" || err != nil {
+			return "", "", phase, err
+		}
+		status.MigratedVersion = from
+	}
+	// only the images in use are remembered
+	for known := range status.ImageVersions {
+		if known != image && known != status.MigratedImage && known != r.sentry.Spec.SentryImage &&
+			(r.sentry.Spec.Canary == nil || known != r.sentry.Spec.Canary.Image) {
+			delete(status.ImageVersions, known)
+		}
+	}
+
+	switch {
+	case from == "" || to == "":
+		return "UnknownVersion", fmt.Sprintf("the version of %s or %s couldn't be found", status.MigratedImage, image), "", nil
+	case compareVersions(to, from) < 0:
+		return "Downgrade", versionSkew(from, to), "", nil
+	}
+	if problem := versionSkew(from, to); problem != "" {
+		return "UnsupportedUpgrade", problem, "", nil
+	}
+	return "Compatible", fmt.Sprintf("migrating from %s to %s", from, to), "", nil
+}
+
+// makes sure the migrations of image can run on the schema of the migrated
+// version; returns the phase to report until they can
+func (r *ReconcileSentry) checkVersionSkew(image string) (string, error) {
+	status := &r.sentry.Status
+
+	reason, problem, phase, err := r.versionProblem(image)
+	if phase != "" || err != nil {
+		return phase, err
+	}
+	if reason == "Compatible" {
+		status.SetCondition(v1alpha1.ConditionVersionCompatible, corev1.ConditionTrue, reason, problem)
+		return "", nil
+	}
+
+	if r.sentry.Annotations[v1alpha1.AllowVersionSkewAnnotation] == image {
+		if c := status.GetCondition(v1alpha1.ConditionVersionCompatible); c == nil || c.Reason != "Overridden" {
+			r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "VersionSkewOverridden", "Migrating to %s as the %s annotation asks: %s", image, v1alpha1.AllowVersionSkewAnnotation, problem)
+		}
+		status.SetCondition(v1alpha1.ConditionVersionCompatible, corev1.ConditionFalse, "Overridden", problem)
+		return "", nil
+	}
+
+	if c := status.GetCondition(v1alpha1.ConditionVersionCompatible); c == nil || c.Message != problem {
+		r.recorder.Eventf(r.sentry, corev1.EventTypeWarning, "VersionSkewBlocked", "Not migrating to %s: %s, set the %s annotation to it to proceed anyway", image, problem, v1alpha1.AllowVersionSkewAnnotation)
+	}
+	status.SetCondition(v1alpha1.ConditionVersionCompatible, corev1.ConditionFalse, reason, problem)
+	return "VersionSkewBlocked", nil
+}
@@ -0,0 +1,87 @@
+package sentry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersionFromTag(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"docker.io/sentry:23.6.2", "23.6.2"},
+		{"getsentry/sentry:9.1.2", "9.1.2"},
+		{"sentry:v9.1", "9.1"},
+		{"sentry:20.6.0-py3", "20.6.0"},
+		{"getsentry/sentry:24.1.0-rc1", "24.1.0"},
+		{"registry.local:5000/sentry:23.11.0", "23.11.0"},
+		{"getsentry/sentry:nightly", ""},
+		{"docker.io/sentry:latest", ""},
+		{"sentry:9", ""},
+		{"sentry", ""},
+		{"registry.local:5000/sentry", ""},
+		{"getsentry/sentry@sha256:4b6d2a2f8e3c3e4a5e1f0d9c8b7a6e5d4c3b2a1f0e9d8c7b6a5f4e3d2c1b0a9f", ""},
+		{"getsentry/sentry:23.6.2@sha256:4b6d2a2f8e3c3e4a5e1f0d9c8b7a6e5d4c3b2a1f0e9d8c7b6a5f4e3d2c1b0a9f", ""},
+	}
+	for _, tt := range tests {
+		if got := versionFromTag(tt.image); got != tt.want {
+			t.Errorf("versionFromTag(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"23.6.2", "23.6.2", 0},
+		{"9.1", "9.1.0", 0},
+		{"9.1.2", "10.0.0", -1},
+		{"23.11.0", "23.6.2", 1},
+		{"23.6.10", "23.6.9", 1},
+		{"21.5", "21.5.1", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestVersionSkew(t *testing.T) {
+	// want is empty when the upgrade is supported, otherwise a part of the
+	// reason it isn't
+	tests := []struct {
+		from, to string
+		want     string
+	}{
+		{"23.6.2", "23.6.2", ""},
+		{"23.6.2", "23.10.0", ""},
+		{"9.1.1", "9.1.2", ""},
+		{"9.1.1", "21.5.0", "upgrade to 9.1.2 first"},
+		{"9.1.2", "21.5.0", ""},
+		{"10.0.0", "21.5.0", ""},
+		{"20.6.0", "21.5.0", ""},
+		{"21.5.0", "21.6.3", ""},
+		{"21.5.0", "21.7.0", "upgrade to 21.6.3 first"},
+		{"21.6.3", "23.6.2", ""},
+		{"21.6.3", "23.6.3", "upgrade to 23.6.2 first"},
+		{"23.6.2", "23.11.0", ""},
+		{"23.6.2", "23.11.1", "upgrade to 23.11.0 first"},
+		{"23.11.0", "24.8.0", ""},
+		{"23.11.0", "24.9.0", "upgrade to 24.8.0 first"},
+		{"24.8.0", "25.5.1", ""},
+		{"24.8.0", "25.6.0", "upgrade to 25.5.1 first"},
+		{"9.1.1", "25.6.0", "upgrade to 9.1.2 first"},
+		{"23.6.2", "23.6.1", "older than the migrated version"},
+		{"24.8.0", "23.6.2", "older than the migrated version"},
+	}
+	for _, tt := range tests {
+		got := versionSkew(tt.from, tt.to)
+		if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+			t.Errorf("versionSkew(%q, %q) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package sentrybackup
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	"github.com/sd-hackday-sentry/sentry-operator/pkg/controller/sentry"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("sentrybackup")
+
+// Add creates a new SentryBackup Controller and adds it to the Manager. The Manager
+// will set fields on the Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileSentryBackup{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("sentrybackup-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource SentryBackup
+	err = c.Watch(&source.Kind{Type: &v1alpha1.SentryBackup{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch the backup jobs so their progress is reported right away
+	err = c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &v1alpha1.SentryBackup{},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// blank assignment to verify that ReconcileSentryBackup implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileSentryBackup{}
+
+// ReconcileSentryBackup reconciles a SentryBackup object
+type ReconcileSentryBackup struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client client.Client
+	scheme *runtime.Scheme
+	logger logr.Logger
+}
+
+// validates the parts of the spec the CRD schema can't express
+func validateSpec(spec *v1alpha1.SentryBackupSpec) error {
+	errors := []string{}
+
+	if spec.Sentry == "" {
+		errors = append(errors, "sentry is required")
+	}
+	if spec.Retention < 0 {
+		errors = append(errors, "retention can't be negative")
+	}
+	if (spec.Storage.PersistentVolumeClaim == "") == (spec.Storage.S3 == nil) {
+		errors = append(errors, "storage needs exactly one of persistentVolumeClaim or s3")
+	}
+	if s3 := spec.Storage.S3; s3 != nil {
+		if s3.Bucket == "" {
+			errors = append(errors, "s3 needs a bucket")
+		}
+		if s3.CredentialsSecret == "" {
+			errors = append(errors, "s3 needs a credentialsSecret")
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("invalid spec: %s", strings.Join(errors, ", "))
+	}
+	return nil
+}
+
+// Reconcile runs the backup job of a SentryBackup and reports its outcome,
+// a backup runs only once, finished backups are left alone
+func (r *ReconcileSentryBackup) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	r.logger = log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	r.logger.Info("Reconciling SentryBackup")
+
+	backup := &v1alpha1.SentryBackup{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, backup)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if backup.Finished() {
+		return reconcile.Result{}, nil
+	}
+
+	backup.SetDefaults()
+	if err := validateSpec(&backup.Spec); err != nil {
+		return reconcile.Result{}, r.fail(backup, err.Error())
+	}
+
+	instance := &v1alpha1.Sentry{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: backup.Namespace, Name: backup.Spec.Sentry}, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, r.fail(backup, fmt.Sprintf("sentry '%s' was not found in namespace '%s'", backup.Spec.Sentry, backup.Namespace))
+		}
+		return reconcile.Result{}, err
+	}
+	instance.SetDefaults()
+
+	job, state, err := sentry.GetJobState(r.client, backup.Namespace, jobName(backup))
+	if err != nil {
+		r.logger.Error(err, "Failed to get Job.", "Job.Name", jobName(backup))
+		return reconcile.Result{}, err
+	}
+
+	status := &backup.Status
+	switch state {
+	case sentry.JobMissing:
+		job = r.jobForBackup(backup, instance)
+		r.logger.Info("Creating a new Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.client.Create(context.TODO(), job); err != nil {
+			r.logger.Error(err, "Failed to create Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return reconcile.Result{}, err
+		}
+		status.Phase = v1alpha1.BackupPending
+	case sentry.JobRunning:
+		status.Phase = v1alpha1.BackupPending
+		if job.Status.StartTime != nil {
+			status.Phase = v1alpha1.BackupRunning
+			status.StartTime = job.Status.StartTime
+		}
+	case sentry.JobComplete:
+		message, err := sentry.JobTerminationMessage(r.client, job.Namespace, job.Name)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		// the size of the dump, then the dumps the retention dropped
+		lines := strings.Split(strings.TrimSpace(message), "\n")
+		size, err := strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+		if err != nil {
+			r.logger.Info("Couldn't read the size of the dump.", "Message", message)
+		}
+		status.Phase = v1alpha1.BackupCompleted
+		status.StartTime = job.Status.StartTime
+		status.CompletionTime = job.Status.CompletionTime
+		if status.StartTime != nil && status.CompletionTime != nil {
+			status.Duration = status.CompletionTime.Sub(status.StartTime.Time).String()
+		}
+		status.Size = size
+		status.Location = dumpLocation(backup)
+		r.logger.Info("Backup completed.", "Location", status.Location, "Size", status.Size, "Duration", status.Duration)
+		if err := r.markPruned(backup, lines[1:]); err != nil {
+			return reconcile.Result{}, err
+		}
+	case sentry.JobFailed:
+		return reconcile.Result{}, r.fail(backup, fmt.Sprintf("the backup failed, see the logs of job '%s'", job.Name))
+	}
+
+	return reconcile.Result{}, r.updateStatus(backup)
+}
+
+// marks the backups whose dump was dropped by the retention of backup, their
+// dump can't be restored anymore
+func (r *ReconcileSentryBackup) markPruned(backup *v1alpha1.SentryBackup, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	dir := strings.TrimSuffix(dumpLocation(backup), DumpFile(backup))
+	pruned := map[string]bool{}
+	for _, f := range files {
+		pruned[dir+strings.TrimSpace(f)] = true
+	}
+
+	backups := &v1alpha1.SentryBackupList{}
+	if err := r.client.List(context.TODO(), client.InNamespace(backup.Namespace), backups); err != nil {
+		r.logger.Error(err, "Failed to list SentryBackups.")
+		return err
+	}
+	for i := range backups.Items {
+		old := &backups.Items[i]
+		if old.Status.Phase != v1alpha1.BackupCompleted || !pruned[old.Status.Location] {
+			continue
+		}
+		r.logger.Info("Marking SentryBackup as pruned.", "SentryBackup.Name", old.Name, "Location", old.Status.Location)
+		old.Status.Phase = v1alpha1.BackupPruned
+		old.Status.Message = fmt.Sprintf("the dump was deleted by the retention of backup '%s'", backup.Name)
+		if err := r.updateStatus(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marks the backup as failed for good
+func (r *ReconcileSentryBackup) fail(backup *v1alpha1.SentryBackup, message string) error {
+	r.logger.Info("Backup failed.", "Reason", message)
+	backup.Status.Phase = v1alpha1.BackupFailed
+	backup.Status.Message = message
+	return r.updateStatus(backup)
+}
+
+func (r *ReconcileSentryBackup) updateStatus(backup *v1alpha1.SentryBackup) error {
+	err := r.client.Status().Update(context.TODO(), backup)
+	if err != nil {
+		r.logger.Error(err, "Failed to update SentryBackup status.")
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package sentrybackup
+
+import (
+	"fmt"
+	"strconv"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	"github.com/sd-hackday-sentry/sentry-operator/pkg/controller/sentry"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	backupPath = "/backup"
+	workPath   = "/work"
+)
+
+// matches the dumps of the backups taken before an upgrade, a rollback relies
+// on them so only the retention of other pre-upgrade backups drops them
+const upgradeDump = `-pre-upgrade-[0-9a-f]+\.dump$`
+
+// dumps the database straight to the claim then drops the oldest dumps of the
+// same kind, file names start with a timestamp so sorting them sorts them by
+// age; the dropped ones are reported after the size of the dump
+const pvcBackupScript = `set -e
+dir="` + backupPath + `/$BACKUP_PREFIX"
+mkdir -p "$dir"
+pg_dump --format=custom --no-owner --file="$dir/$BACKUP_FILE.partial"
+mv "$dir/$BACKUP_FILE.partial" "$dir/$BACKUP_FILE"
+wc -c < "$dir/$BACKUP_FILE" > /dev/termination-log
+if [ "$BACKUP_RETENTION" -gt 0 ]; then
+  ls -1 "$dir"/*.dump | grep $BACKUP_PRUNE_FLAGS -e '` + upgradeDump + `' | sort -r | tail -n +$((BACKUP_RETENTION + 1)) | while read -r old; do
+    rm -f "$old"
+    basename "$old" >> /dev/termination-log
+  done
+fi
+`
+
+// dumps the database to the scratch volume for the uploader
+const dumpScript = `set -e
+pg_dump --format=custom --no-owner --file="` + workPath + `/$BACKUP_FILE"
+`
+
+// uploads the dump then drops the oldest dumps of the same kind right under
+// the prefix, the dropped ones are reported after the size of the dump
+const s3UploadScript = `set -e
+mc() { command mc --quiet --config-dir ` + workPath + `/.mc "$@"; }
+mc alias set target "$S3_ENDPOINT" "$AWS_ACCESS_KEY_ID" "$AWS_SECRET_ACCESS_KEY" > /dev/null
+mc cp "` + workPath + `/$BACKUP_FILE" "target/$S3_BUCKET/$BACKUP_PREFIX/$BACKUP_FILE"
+wc -c < "` + workPath + `/$BACKUP_FILE" > /dev/termination-log
+if [ "$BACKUP_RETENTION" -gt 0 ]; then
+  mc find "target/$S3_BUCKET/$BACKUP_PREFIX" --maxdepth 1 --name '*.dump' | grep $BACKUP_PRUNE_FLAGS -e '` + upgradeDump + `' | sort -r | tail -n +$((BACKUP_RETENTION + 1)) | while read -r old; do
+    mc rm "$old"
+    basename "$old" >> /dev/termination-log
+  done
+fi
+`
+
+// DumpFile returns the name of the file the dump of b is written to, under
+// the prefix of its storage
+func DumpFile(b *v1alpha1.SentryBackup) string {
+	return fmt.Sprintf("%s-%s.dump", b.CreationTimestamp.UTC().Format("20060102T150405Z"), b.Name)
+}
+
+// returns where the dump ends up
+func dumpLocation(b *v1alpha1.SentryBackup) string {
+	if s3 := b.Spec.Storage.S3; s3 != nil {
+		return fmt.Sprintf("s3://%s/%s/%s", s3.Bucket, b.Spec.Prefix, DumpFile(b))
+	}
+	return fmt.Sprintf("pvc://%s/%s/%s", b.Spec.Storage.PersistentVolumeClaim, b.Spec.Prefix, DumpFile(b))
+}
+
+// S3Env returns the environment the uploader scripts use to reach a bucket
+func S3Env(s3 *v1alpha1.S3Storage) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name:  "S3_ENDPOINT",
+			Value: s3.Endpoint,
+		},
+		{
+			Name:  "S3_BUCKET",
+			Value: s3.Bucket,
+		},
+		{
+			Name: "AWS_ACCESS_KEY_ID",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: s3.AccessKeyIDSelector(),
+			},
+		},
+		{
+			Name: "AWS_SECRET_ACCESS_KEY",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: s3.SecretAccessKeySelector(),
+			},
+		},
+	}
+}
+
+// returns the grep flags selecting the dumps the retention of b may drop
+func pruneFlags(b *v1alpha1.SentryBackup) string {
+	if sentry.IsUpgradeBackup(b) {
+		return "-E"
+	}
+	return "-E -v"
+}
+
+func jobName(b *v1alpha1.SentryBackup) string {
+	return "sentry-backup-" + b.Name
+}
+
+// job dumping the database of s to the storage of b
+func (r *ReconcileSentryBackup) jobForBackup(b *v1alpha1.SentryBackup, s *v1alpha1.Sentry) *batchv1.Job {
+	backupEnv := []corev1.EnvVar{
+		{
+			Name:  "BACKUP_FILE",
+			Value: DumpFile(b),
+		},
+		{
+			Name:  "BACKUP_PREFIX",
+			Value: b.Spec.Prefix,
+		},
+		{
+			Name:  "BACKUP_RETENTION",
+			Value: strconv.Itoa(b.Spec.Retention),
+		},
+		{
+			Name:  "BACKUP_PRUNE_FLAGS",
+			Value: pruneFlags(b),
+		},
+	}
+	volumes, mounts, env := sentry.PostgresClient(s)
+	env = append(env, backupEnv...)
+
+	dump := corev1.Container{
+		Name:            "pg-dump",
+		Image:           b.Spec.Image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c", pvcBackupScript},
+		Env:             env,
+		VolumeMounts:    mounts,
+	}
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+	}
+
+	if s3 := b.Spec.Storage.S3; s3 != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name: "work",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		work := corev1.VolumeMount{
+			Name:      "work",
+			MountPath: workPath,
+		}
+		dump.Command = []string{"/bin/sh", "-c", dumpScript}
+		dump.VolumeMounts = append(dump.VolumeMounts, work)
+		podSpec.InitContainers = []corev1.Container{dump}
+		podSpec.Containers = []corev1.Container{{
+			Name:            "upload",
+			Image:           b.Spec.UploaderImage,
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Command:         []string{"/bin/sh", "-c", s3UploadScript},
+			Env:             append(backupEnv, S3Env(s3)...),
+			VolumeMounts:    []corev1.VolumeMount{work},
+		}}
+	} else {
+		volumes = append(volumes, corev1.Volume{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: b.Spec.Storage.PersistentVolumeClaim,
+				},
+			},
+		})
+		dump.VolumeMounts = append(dump.VolumeMounts, corev1.VolumeMount{
+			Name:      "backup",
+			MountPath: backupPath,
+		})
+		podSpec.Containers = []corev1.Container{dump}
+	}
+	podSpec.Volumes = volumes
+
+	labels := map[string]string{
+		"app":                      "sentry-backup",
+		"sentry.redhat.com/backup": b.Name,
+	}
+	backoffLimit := int32(1)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName(b),
+			Namespace: b.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(b, job, r.scheme)
+	return job
+}
@@ -0,0 +1,238 @@
+package sentrybackupschedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("sentrybackupschedule")
+
+const scheduleLabel = "sentry.redhat.com/backup-schedule"
+
+// Add creates a new SentryBackupSchedule Controller and adds it to the Manager. The Manager
+// will set fields on the Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileSentryBackupSchedule{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("sentrybackupschedule-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource SentryBackupSchedule
+	err = c.Watch(&source.Kind{Type: &v1alpha1.SentryBackupSchedule{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch the backups we took so old ones are pruned as soon as new ones finish
+	err = c.Watch(&source.Kind{Type: &v1alpha1.SentryBackup{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &v1alpha1.SentryBackupSchedule{},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// blank assignment to verify that ReconcileSentryBackupSchedule implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileSentryBackupSchedule{}
+
+// ReconcileSentryBackupSchedule reconciles a SentryBackupSchedule object
+type ReconcileSentryBackupSchedule struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client client.Client
+	scheme *runtime.Scheme
+	logger logr.Logger
+}
+
+// Reconcile creates a SentryBackup whenever one is due and prunes the
+// finished ones beyond the retention, then waits for the next one to be due.
+// Backups missed while the operator was down are caught up with a single one.
+func (r *ReconcileSentryBackupSchedule) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	r.logger = log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	r.logger.Info("Reconciling SentryBackupSchedule")
+
+	schedule := &v1alpha1.SentryBackupSchedule{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, schedule)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	schedule.SetDefaults()
+	status := &schedule.Status
+
+	cron, err := parseSchedule(schedule.Spec.Schedule)
+	if err == nil && schedule.Spec.Template.Retention < 0 {
+		err = fmt.Errorf("retention can't be negative")
+	}
+	if err == nil && *schedule.Spec.FailedBackupsHistoryLimit < 0 {
+		err = fmt.Errorf("failedBackupsHistoryLimit can't be negative")
+	}
+	if err != nil {
+		r.logger.Info("Invalid spec.", "Error", err.Error())
+		status.Message = err.Error()
+		status.NextScheduleTime = nil
+		return reconcile.Result{}, r.updateStatus(schedule)
+	}
+	status.Message = ""
+
+	now := time.Now().UTC()
+	last := schedule.CreationTimestamp.Time
+	if status.LastScheduleTime != nil {
+		last = status.LastScheduleTime.Time
+	}
+	next := cron.next(last)
+
+	if !schedule.Spec.Suspend && !next.After(now) {
+		running, err := r.lastBackupRunning(schedule)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if running {
+			// dumps of the same database don't run concurrently
+			r.logger.Info("Skipping backup, the previous one is still running.", "SentryBackup.Name", status.LastBackup)
+			status.Message = fmt.Sprintf("skipped the backup due at %s, '%s' was still running", next.Format(time.RFC3339), status.LastBackup)
+		} else {
+			backup := r.backupForSchedule(schedule, now)
+			r.logger.Info("Creating a new SentryBackup.", "SentryBackup.Namespace", backup.Namespace, "SentryBackup.Name", backup.Name)
+			if err := r.client.Create(context.TODO(), backup); err != nil && !errors.IsAlreadyExists(err) {
+				r.logger.Error(err, "Failed to create SentryBackup.", "SentryBackup.Namespace", backup.Namespace, "SentryBackup.Name", backup.Name)
+				return reconcile.Result{}, err
+			}
+			status.LastBackup = backup.Name
+		}
+		status.LastScheduleTime = &metav1.Time{Time: now}
+		next = cron.next(now)
+	}
+
+	if err := r.prune(schedule); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if schedule.Spec.Suspend {
+		status.NextScheduleTime = nil
+		return reconcile.Result{}, r.updateStatus(schedule)
+	}
+	status.NextScheduleTime = &metav1.Time{Time: next}
+	return reconcile.Result{RequeueAfter: next.Sub(now)}, r.updateStatus(schedule)
+}
+
+// returns a backup of the schedule taken at t
+func (r *ReconcileSentryBackupSchedule) backupForSchedule(schedule *v1alpha1.SentryBackupSchedule, t time.Time) *v1alpha1.SentryBackup {
+	backup := &v1alpha1.SentryBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%s", schedule.Name, t.Format("20060102-150405")),
+			Namespace: schedule.Namespace,
+			Labels: map[string]string{
+				scheduleLabel: schedule.Name,
+			},
+		},
+		Spec: schedule.Spec.Template,
+	}
+
+	controllerutil.SetControllerReference(schedule, backup, r.scheme)
+	return backup
+}
+
+func (r *ReconcileSentryBackupSchedule) lastBackupRunning(schedule *v1alpha1.SentryBackupSchedule) (bool, error) {
+	if schedule.Status.LastBackup == "" {
+		return false, nil
+	}
+	backup := &v1alpha1.SentryBackup{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: schedule.Namespace, Name: schedule.Status.LastBackup}, backup)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !backup.Finished(), nil
+}
+
+// returns the finished backups to delete: the successful ones beyond the
+// retention and the failed ones beyond their own limit, failed runs never
+// push out a backup that can still be restored
+func expiredBackups(backups []v1alpha1.SentryBackup, retention, failedLimit int) []v1alpha1.SentryBackup {
+	sorted := append([]v1alpha1.SentryBackup{}, backups...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+	})
+
+	expired := []v1alpha1.SentryBackup{}
+	succeeded, failed := 0, 0
+	for _, b := range sorted {
+		switch b.Status.Phase {
+		case v1alpha1.BackupCompleted, v1alpha1.BackupPruned:
+			if succeeded++; succeeded > retention {
+				expired = append(expired, b)
+			}
+		case v1alpha1.BackupFailed:
+			if failed++; failed > failedLimit {
+				expired = append(expired, b)
+			}
+		}
+	}
+	return expired
+}
+
+// deletes the oldest finished backups beyond the retention, the dumps
+// themselves are pruned by the backup jobs
+func (r *ReconcileSentryBackupSchedule) prune(schedule *v1alpha1.SentryBackupSchedule) error {
+	backups := &v1alpha1.SentryBackupList{}
+	opts := client.InNamespace(schedule.Namespace).MatchingLabels(map[string]string{scheduleLabel: schedule.Name})
+	if err := r.client.List(context.TODO(), opts, backups); err != nil {
+		r.logger.Error(err, "Failed to list SentryBackups.")
+		return err
+	}
+
+	expired := expiredBackups(backups.Items, schedule.Spec.Template.Retention, int(*schedule.Spec.FailedBackupsHistoryLimit))
+	for i := range expired {
+		b := &expired[i]
+		r.logger.Info("Deleting SentryBackup.", "SentryBackup.Namespace", b.Namespace, "SentryBackup.Name", b.Name)
+		if err := r.client.Delete(context.TODO(), b); err != nil && !errors.IsNotFound(err) {
+			r.logger.Error(err, "Failed to delete SentryBackup.", "SentryBackup.Name", b.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ReconcileSentryBackupSchedule) updateStatus(schedule *v1alpha1.SentryBackupSchedule) error {
+	err := r.client.Status().Update(context.TODO(), schedule)
+	if err != nil {
+		r.logger.Error(err, "Failed to update SentryBackupSchedule status.")
+	}
+	return err
+}
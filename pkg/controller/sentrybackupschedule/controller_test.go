@@ -0,0 +1,98 @@
+package sentrybackupschedule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// returns backups named after their index, the first one is the oldest and
+// each is one hour younger than the one before
+func backupsWithPhases(phases ...v1alpha1.SentryBackupPhase) []v1alpha1.SentryBackup {
+	start := date("2021-01-01T00:00:00Z")
+	backups := []v1alpha1.SentryBackup{}
+	for i, phase := range phases {
+		backups = append(backups, v1alpha1.SentryBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              string(rune('a' + i)),
+				CreationTimestamp: metav1.Time{Time: start.Add(time.Duration(i) * time.Hour)},
+			},
+			Status: v1alpha1.SentryBackupStatus{Phase: phase},
+		})
+	}
+	return backups
+}
+
+func TestExpiredBackups(t *testing.T) {
+	const (
+		completed = v1alpha1.BackupCompleted
+		pruned    = v1alpha1.BackupPruned
+		failed    = v1alpha1.BackupFailed
+		running   = v1alpha1.BackupRunning
+		pending   = v1alpha1.BackupPending
+	)
+	tests := []struct {
+		name        string
+		phases      []v1alpha1.SentryBackupPhase
+		retention   int
+		failedLimit int
+		want        []string
+	}{
+		{
+			name:        "within the retention",
+			phases:      []v1alpha1.SentryBackupPhase{completed, completed},
+			retention:   2,
+			failedLimit: 1,
+			want:        []string{},
+		},
+		{
+			name:        "oldest successful ones go first",
+			phases:      []v1alpha1.SentryBackupPhase{completed, completed, completed, completed},
+			retention:   2,
+			failedLimit: 1,
+			want:        []string{"b", "a"},
+		},
+		{
+			name:        "pruned ones count towards the retention",
+			phases:      []v1alpha1.SentryBackupPhase{pruned, pruned, completed, completed},
+			retention:   3,
+			failedLimit: 1,
+			want:        []string{"a"},
+		},
+		{
+			name:        "failed runs never evict successful backups",
+			phases:      []v1alpha1.SentryBackupPhase{completed, completed, failed, failed, failed, failed, failed},
+			retention:   2,
+			failedLimit: 3,
+			want:        []string{"d", "c"},
+		},
+		{
+			name:        "failed runs in between",
+			phases:      []v1alpha1.SentryBackupPhase{completed, failed, completed, failed, completed},
+			retention:   2,
+			failedLimit: 0,
+			want:        []string{"d", "b", "a"},
+		},
+		{
+			name:        "unfinished ones are kept",
+			phases:      []v1alpha1.SentryBackupPhase{completed, completed, pending, running},
+			retention:   1,
+			failedLimit: 0,
+			want:        []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, b := range expiredBackups(backupsWithPhases(tt.phases...), tt.retention, tt.failedLimit) {
+				got = append(got, b.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expiredBackups() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package sentrybackupschedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// a parsed cron expression, each field is a bitset of the values it matches
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// whether day of month and day of week were left unrestricted
+	domAny, dowAny bool
+}
+
+// parses the standard five fields cron format: lists, ranges and steps are
+// supported, names of months and days aren't
+func parseSchedule(spec string) (*cronSchedule, error) {
+	if expanded, ok := cronMacros[spec]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule '%s' doesn't have five fields", spec)
+	}
+
+	s := &cronSchedule{
+		domAny: strings.HasPrefix(fields[2], "*"),
+		dowAny: strings.HasPrefix(fields[4], "*"),
+	}
+	limits := []struct {
+		bits     *uint64
+		name     string
+		min, max int
+	}{
+		{&s.minute, "minute", 0, 59},
+		{&s.hour, "hour", 0, 23},
+		{&s.dom, "day of month", 1, 31},
+		{&s.month, "month", 1, 12},
+		{&s.dow, "day of week", 0, 7},
+	}
+	for i, l := range limits {
+		bits, err := parseCronField(fields[i], l.min, l.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in schedule '%s': %s", l.name, spec, err)
+		}
+		*l.bits = bits
+	}
+	// both 0 and 7 are sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule '%s' never matches", spec)
+	}
+	return s, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		values, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			values = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+		}
+
+		lo, hi := min, max
+		if values != "*" {
+			bounds := strings.SplitN(values, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in '%s'", part)
+			}
+			switch {
+			case len(bounds) == 2:
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value in '%s'", part)
+				}
+			case step == 1:
+				hi = lo
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("'%s' is out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	// like cron, a day matches either field when both are restricted
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// returns the first time matching the schedule strictly after t, in UTC, or
+// the zero time if nothing matches within five years
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,96 @@
+package sentrybackupschedule
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestNext(t *testing.T) {
+	// 2021-01-01 is a friday
+	tests := []struct {
+		name     string
+		schedule string
+		from     string
+		want     string
+	}{
+		{"every minute", "* * * * *", "2021-01-01T00:00:00Z", "2021-01-01T00:01:00Z"},
+		{"strictly after", "0 0 * * *", "2021-01-01T00:00:00Z", "2021-01-02T00:00:00Z"},
+		{"seconds are dropped", "* * * * *", "2021-01-01T00:00:59Z", "2021-01-01T00:01:00Z"},
+		{"step", "*/15 * * * *", "2021-01-01T00:07:00Z", "2021-01-01T00:15:00Z"},
+		{"step from a value", "5/15 * * * *", "2021-01-01T00:21:00Z", "2021-01-01T00:35:00Z"},
+		{"step over hours", "0 */6 * * *", "2021-01-01T07:00:00Z", "2021-01-01T12:00:00Z"},
+		{"range", "0 9-17 * * *", "2021-01-01T17:30:00Z", "2021-01-02T09:00:00Z"},
+		{"range with step", "0 9-17/4 * * *", "2021-01-01T14:00:00Z", "2021-01-01T17:00:00Z"},
+		{"list", "0 3,15 * * *", "2021-01-01T04:00:00Z", "2021-01-01T15:00:00Z"},
+		{"list of ranges", "0 1-2,22-23 * * *", "2021-01-01T03:00:00Z", "2021-01-01T22:00:00Z"},
+		{"daily macro", "@daily", "2021-01-01T10:00:00Z", "2021-01-02T00:00:00Z"},
+		{"hourly macro", "@hourly", "2021-01-01T10:00:00Z", "2021-01-01T11:00:00Z"},
+		{"weekly macro", "@weekly", "2021-01-01T00:00:00Z", "2021-01-03T00:00:00Z"},
+		{"monthly macro", "@monthly", "2021-01-15T00:00:00Z", "2021-02-01T00:00:00Z"},
+		{"day of week", "0 0 * * 1", "2021-01-01T00:00:00Z", "2021-01-04T00:00:00Z"},
+		{"sunday as 7", "0 0 * * 7", "2021-01-01T00:00:00Z", "2021-01-03T00:00:00Z"},
+		{"day of week range", "0 0 * * 1-5", "2021-01-01T12:00:00Z", "2021-01-04T00:00:00Z"},
+		{"day of month", "0 0 13 * *", "2021-01-02T00:00:00Z", "2021-01-13T00:00:00Z"},
+		{"day of month or week, week first", "0 0 13 * 5", "2021-01-02T00:00:00Z", "2021-01-08T00:00:00Z"},
+		{"day of month or week, month first", "0 0 13 * 5", "2021-01-09T00:00:00Z", "2021-01-13T00:00:00Z"},
+		{"starred day of month with a step and day of week", "0 0 */2 * 1", "2021-01-01T00:00:00Z", "2021-01-11T00:00:00Z"},
+		{"month rollover", "0 0 1 * *", "2021-01-31T10:00:00Z", "2021-02-01T00:00:00Z"},
+		{"skips short months", "0 0 31 * *", "2021-01-31T00:00:00Z", "2021-03-31T00:00:00Z"},
+		{"month range", "0 0 1 6-8 *", "2021-08-02T00:00:00Z", "2022-06-01T00:00:00Z"},
+		{"year rollover", "0 0 1 1 *", "2021-06-15T00:00:00Z", "2022-01-01T00:00:00Z"},
+		{"last minute of the year", "59 23 31 12 *", "2021-12-31T23:59:00Z", "2022-12-31T23:59:00Z"},
+		{"leap day", "0 0 29 2 *", "2021-03-01T00:00:00Z", "2024-02-29T00:00:00Z"},
+		{"other time zone", "0 0 * * *", "2021-01-01T01:30:00+02:00", "2021-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.schedule)
+			if err != nil {
+				t.Fatalf("parseSchedule(%q) failed: %s", tt.schedule, err)
+			}
+			got := s.next(date(tt.from))
+			if want := date(tt.want); !got.Equal(want) || got.Location() != time.UTC {
+				t.Errorf("next(%s) of %q = %s, want %s", tt.from, tt.schedule, got, want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleRejects(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@every 1h",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"-1 * * * *",
+		"5-1 * * * *",
+		"1-a * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"*/0 * * * *",
+		"*/a * * * *",
+		"0 0 1 JAN *",
+		"0 0 * * MON",
+		"0 0 30 2 *",
+	}
+	for _, spec := range tests {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
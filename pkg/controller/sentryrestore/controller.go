@@ -0,0 +1,342 @@
+package sentryrestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	"github.com/sd-hackday-sentry/sentry-operator/pkg/controller/sentry"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("sentryrestore")
+
+// how often progress outside of our own jobs is checked
+const pollInterval = 10 * time.Second
+
+// Add creates a new SentryRestore Controller and adds it to the Manager. The Manager
+// will set fields on the Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileSentryRestore{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("sentryrestore-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource SentryRestore
+	err = c.Watch(&source.Kind{Type: &v1alpha1.SentryRestore{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch the restore jobs so their completion is noticed right away
+	err = c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &v1alpha1.SentryRestore{},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// blank assignment to verify that ReconcileSentryRestore implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileSentryRestore{}
+
+// ReconcileSentryRestore reconciles a SentryRestore object
+type ReconcileSentryRestore struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client client.Client
+	scheme *runtime.Scheme
+	logger logr.Logger
+}
+
+// Reconcile walks a SentryRestore through its phases: the Sentry instance is
+// paused so its processes scale down, the backup is restored, the upgrader job
+// is deleted so the sentry controller runs the migrations again for the
+// current image, and the instance is resumed
+func (r *ReconcileSentryRestore) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	r.logger = log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	r.logger.Info("Reconciling SentryRestore")
+
+	restore := &v1alpha1.SentryRestore{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, restore)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if restore.Finished() {
+		return reconcile.Result{}, nil
+	}
+	if restore.Spec.Sentry == "" || restore.Spec.Backup == "" {
+		return reconcile.Result{}, r.fail(restore, nil, "invalid spec: sentry and backup are required")
+	}
+
+	instance := &v1alpha1.Sentry{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: restore.Namespace, Name: restore.Spec.Sentry}, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, r.fail(restore, nil, fmt.Sprintf("sentry '%s' was not found in namespace '%s'", restore.Spec.Sentry, restore.Namespace))
+		}
+		return reconcile.Result{}, err
+	}
+
+	switch restore.Status.Phase {
+	case "", v1alpha1.RestorePending:
+		return r.start(restore, instance)
+	case v1alpha1.RestoreScalingDown:
+		return r.waitForScaleDown(restore)
+	case v1alpha1.RestoreRestoring:
+		return r.restore(restore, instance)
+	case v1alpha1.RestoreUpgrading:
+		return r.waitForUpgrade(restore, instance)
+	}
+	return reconcile.Result{}, nil
+}
+
+// returns the completed backup to restore, or nil once the restore failed
+func (r *ReconcileSentryRestore) getBackup(restore *v1alpha1.SentryRestore, instance *v1alpha1.Sentry) (*v1alpha1.SentryBackup, error) {
+	backup := &v1alpha1.SentryBackup{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: restore.Namespace, Name: restore.Spec.Backup}, backup)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, r.fail(restore, instance, fmt.Sprintf("backup '%s' was not found in namespace '%s'", restore.Spec.Backup, restore.Namespace))
+		}
+		return nil, err
+	}
+	if backup.Status.Phase == v1alpha1.BackupPruned {
+		return nil, r.fail(restore, instance, fmt.Sprintf("backup '%s' can't be restored: %s", backup.Name, backup.Status.Message))
+	}
+	if backup.Status.Phase != v1alpha1.BackupCompleted {
+		return nil, r.fail(restore, instance, fmt.Sprintf("backup '%s' hasn't completed", backup.Name))
+	}
+	backup.SetDefaults()
+	return backup, nil
+}
+
+// pauses the instance, unless another restore is already underway
+func (r *ReconcileSentryRestore) start(restore *v1alpha1.SentryRestore, instance *v1alpha1.Sentry) (reconcile.Result, error) {
+	status := &restore.Status
+
+	backup, err := r.getBackup(restore, instance)
+	if backup == nil {
+		return reconcile.Result{}, err
+	}
+
+	if owner := instance.Annotations[v1alpha1.PausedAnnotation]; owner != "" && owner != restore.Name {
+		status.Phase = v1alpha1.RestorePending
+		status.Message = fmt.Sprintf("waiting for sentry '%s' to be resumed by '%s'", instance.Name, owner)
+		return reconcile.Result{RequeueAfter: pollInterval}, r.updateStatus(restore)
+	}
+
+	if instance.Annotations == nil {
+		instance.Annotations = map[string]string{}
+	}
+	instance.Annotations[v1alpha1.PausedAnnotation] = restore.Name
+	r.logger.Info("Pausing Sentry.", "Sentry.Namespace", instance.Namespace, "Sentry.Name", instance.Name)
+	if err := r.client.Update(context.TODO(), instance); err != nil {
+		r.logger.Error(err, "Failed to pause Sentry.", "Sentry.Name", instance.Name)
+		return reconcile.Result{}, err
+	}
+
+	status.Phase = v1alpha1.RestoreScalingDown
+	status.StartTime = &metav1.Time{Time: time.Now()}
+	status.Message = "stopping sentry"
+	return reconcile.Result{RequeueAfter: pollInterval}, r.updateStatus(restore)
+}
+
+// waits until no sentry pod is left to touch the database
+func (r *ReconcileSentryRestore) waitForScaleDown(restore *v1alpha1.SentryRestore) (reconcile.Result, error) {
+	status := &restore.Status
+
+	running := 0
+	for _, name := range sentry.Processes {
+		pods := &corev1.PodList{}
+		opts := client.InNamespace(restore.Namespace).MatchingLabels(map[string]string{"app": name})
+		if err := r.client.List(context.TODO(), opts, pods); err != nil {
+			r.logger.Error(err, "Failed to list Pods.", "App", name)
+			return reconcile.Result{}, err
+		}
+		running += len(pods.Items)
+	}
+	if running > 0 {
+		status.Message = fmt.Sprintf("waiting for %d sentry pods to stop", running)
+		return reconcile.Result{RequeueAfter: pollInterval}, r.updateStatus(restore)
+	}
+
+	status.Phase = v1alpha1.RestoreRestoring
+	status.Message = fmt.Sprintf("restoring backup '%s'", restore.Spec.Backup)
+	return reconcile.Result{Requeue: true}, r.updateStatus(restore)
+}
+
+// runs the restore job, then has the migrations run again and resumes sentry
+func (r *ReconcileSentryRestore) restore(restore *v1alpha1.SentryRestore, instance *v1alpha1.Sentry) (reconcile.Result, error) {
+	status := &restore.Status
+
+	job, state, err := sentry.GetJobState(r.client, restore.Namespace, jobName(restore))
+	if err != nil {
+		r.logger.Error(err, "Failed to get Job.", "Job.Name", jobName(restore))
+		return reconcile.Result{}, err
+	}
+
+	switch state {
+	case sentry.JobMissing:
+		backup, err := r.getBackup(restore, instance)
+		if backup == nil {
+			return reconcile.Result{}, err
+		}
+		defaulted := instance.DeepCopy()
+		defaulted.SetDefaults()
+		job = r.jobForRestore(restore, backup, defaulted)
+		r.logger.Info("Creating a new Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.client.Create(context.TODO(), job); err != nil {
+			r.logger.Error(err, "Failed to create Job.", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return reconcile.Result{}, err
+		}
+	case sentry.JobFailed:
+		message, err := sentry.JobTerminationMessage(r.client, job.Namespace, job.Name)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if message == "" {
+			message = fmt.Sprintf("see the logs of job '%s'", job.Name)
+		}
+		return reconcile.Result{}, r.fail(restore, instance, "the restore failed, the database was left as it was: "+message)
+	case sentry.JobComplete:
+		upgrader, _, err := sentry.GetJobState(r.client, restore.Namespace, sentry.UpgraderJobName)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if upgrader != nil {
+			r.logger.Info("Deleting Job.", "Job.Namespace", upgrader.Namespace, "Job.Name", upgrader.Name)
+			if err := sentry.DeleteJob(r.client, upgrader); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+		if err := r.resume(restore, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+		status.Phase = v1alpha1.RestoreUpgrading
+		status.RestoredTime = &metav1.Time{Time: time.Now()}
+		status.Message = "running the migrations and starting sentry"
+		return reconcile.Result{RequeueAfter: pollInterval}, r.updateStatus(restore)
+	}
+	return reconcile.Result{}, nil
+}
+
+// waits for the upgrader job created after the restore and for the sentry
+// deployments to be back up; the status of the instance isn't relied on, a
+// canary or a blue/green upgrade can keep it from reading Running
+func (r *ReconcileSentryRestore) waitForUpgrade(restore *v1alpha1.SentryRestore, instance *v1alpha1.Sentry) (reconcile.Result, error) {
+	status := &restore.Status
+
+	job, state, err := sentry.GetJobState(r.client, restore.Namespace, sentry.UpgraderJobName)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if state == sentry.JobMissing || job.CreationTimestamp.Before(status.RestoredTime) {
+		return reconcile.Result{RequeueAfter: pollInterval}, nil
+	}
+	switch state {
+	case sentry.JobFailed:
+		return reconcile.Result{}, r.fail(restore, instance, fmt.Sprintf("the database was restored but the migrations failed, see the logs of job '%s'", job.Name))
+	case sentry.JobRunning:
+		return reconcile.Result{RequeueAfter: pollInterval}, nil
+	}
+
+	// every process was scaled down for the restore, sentry runs again once
+	// they're scaled back up and rolled out
+	scaledUp := false
+	for _, name := range sentry.Processes {
+		dep := &appsv1.Deployment{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: restore.Namespace}, dep)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			r.logger.Error(err, "Failed to get Deployment.", "Deployment.Name", name)
+			return reconcile.Result{}, err
+		}
+		if dep.Spec.Replicas == nil || *dep.Spec.Replicas > 0 {
+			scaledUp = true
+		}
+		if !sentry.RolledOut(dep) {
+			status.Message = fmt.Sprintf("waiting for %s to roll out", name)
+			return reconcile.Result{RequeueAfter: pollInterval}, r.updateStatus(restore)
+		}
+	}
+	if !scaledUp {
+		status.Message = "waiting for sentry to scale back up"
+		return reconcile.Result{RequeueAfter: pollInterval}, r.updateStatus(restore)
+	}
+
+	r.logger.Info("Restore completed.", "Sentry.Name", instance.Name, "SentryBackup.Name", restore.Spec.Backup)
+	status.Phase = v1alpha1.RestoreCompleted
+	status.CompletionTime = &metav1.Time{Time: time.Now()}
+	status.Message = ""
+	return reconcile.Result{}, r.updateStatus(restore)
+}
+
+// removes the pause we put on the instance
+func (r *ReconcileSentryRestore) resume(restore *v1alpha1.SentryRestore, instance *v1alpha1.Sentry) error {
+	if instance.Annotations[v1alpha1.PausedAnnotation] != restore.Name {
+		return nil
+	}
+	delete(instance.Annotations, v1alpha1.PausedAnnotation)
+	r.logger.Info("Resuming Sentry.", "Sentry.Namespace", instance.Namespace, "Sentry.Name", instance.Name)
+	err := r.client.Update(context.TODO(), instance)
+	if err != nil {
+		r.logger.Error(err, "Failed to resume Sentry.", "Sentry.Name", instance.Name)
+	}
+	return err
+}
+
+// marks the restore as failed for good, resuming the instance if we paused it
+func (r *ReconcileSentryRestore) fail(restore *v1alpha1.SentryRestore, instance *v1alpha1.Sentry, message string) error {
+	if instance != nil {
+		if err := r.resume(restore, instance); err != nil {
+			return err
+		}
+	}
+	r.logger.Info("Restore failed.", "Reason", message)
+	restore.Status.Phase = v1alpha1.RestoreFailed
+	restore.Status.Message = message
+	return r.updateStatus(restore)
+}
+
+func (r *ReconcileSentryRestore) updateStatus(restore *v1alpha1.SentryRestore) error {
+	err := r.client.Status().Update(context.TODO(), restore)
+	if err != nil {
+		r.logger.Error(err, "Failed to update SentryRestore status.")
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package sentryrestore
+
+import (
+	v1alpha1 "github.com/sd-hackday-sentry/sentry-operator/pkg/apis/sentry/v1alpha1"
+	"github.com/sd-hackday-sentry/sentry-operator/pkg/controller/sentry"
+	"github.com/sd-hackday-sentry/sentry-operator/pkg/controller/sentrybackup"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	backupPath = "/backup"
+	workPath   = "/work"
+)
+
+// restores the dump in a single transaction, on failure the database is left
+// as it was and the end of the error output is kept as termination message
+const restoreScript = `set -e
+if ! pg_restore --clean --if-exists --no-owner --single-transaction --exit-on-error --dbname="$PGDATABASE" "$BACKUP_PATH" 2> /tmp/restore.err; then
+  cat /tmp/restore.err >&2
+  tail -c 1024 /tmp/restore.err > /dev/termination-log
+  exit 1
+fi
+`
+
+// fetches the dump from the bucket for the restore
+const s3DownloadScript = `set -e
+mc() { command mc --quiet --config-dir ` + workPath + `/.mc "$@"; }
+mc alias set target "$S3_ENDPOINT" "$AWS_ACCESS_KEY_ID" "$AWS_SECRET_ACCESS_KEY" > /dev/null
+mc cp "target/$S3_BUCKET/$BACKUP_PREFIX/$BACKUP_FILE" "` + workPath + `/$BACKUP_FILE"
+`
+
+func jobName(restore *v1alpha1.SentryRestore) string {
+	return "sentry-restore-" + restore.Name
+}
+
+// job restoring the dump of b into the database of s
+func (r *ReconcileSentryRestore) jobForRestore(restore *v1alpha1.SentryRestore, b *v1alpha1.SentryBackup, s *v1alpha1.Sentry) *batchv1.Job {
+	image := restore.Spec.Image
+	if image == "" {
+		image = b.Spec.Image
+	}
+
+	volumes, mounts, env := sentry.PostgresClient(s)
+	restoreContainer := corev1.Container{
+		Name:            "pg-restore",
+		Image:           image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c", restoreScript},
+		Env:             env,
+		VolumeMounts:    mounts,
+	}
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+	}
+
+	if s3 := b.Spec.Storage.S3; s3 != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name: "work",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		work := corev1.VolumeMount{
+			Name:      "work",
+			MountPath: workPath,
+		}
+		podSpec.InitContainers = []corev1.Container{{
+			Name:            "download",
+			Image:           b.Spec.UploaderImage,
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Command:         []string{"/bin/sh", "-c", s3DownloadScript},
+			Env: append([]corev1.EnvVar{
+				{
+					Name:  "BACKUP_FILE",
+					Value: sentrybackup.DumpFile(b),
+				},
+				{
+					Name:  "BACKUP_PREFIX",
+					Value: b.Spec.Prefix,
+				},
+			}, sentrybackup.S3Env(s3)...),
+			VolumeMounts: []corev1.VolumeMount{work},
+		}}
+		restoreContainer.Env = append(restoreContainer.Env, corev1.EnvVar{
+			Name:  "BACKUP_PATH",
+			Value: workPath + "/" + sentrybackup.DumpFile(b),
+		})
+		restoreContainer.VolumeMounts = append(restoreContainer.VolumeMounts, work)
+	} else {
+		volumes = append(volumes, corev1.Volume{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: b.Spec.Storage.PersistentVolumeClaim,
+					ReadOnly:  true,
+				},
+			},
+		})
+		restoreContainer.Env = append(restoreContainer.Env, corev1.EnvVar{
+			Name:  "BACKUP_PATH",
+			Value: backupPath + "/" + b.Spec.Prefix + "/" + sentrybackup.DumpFile(b),
+		})
+		restoreContainer.VolumeMounts = append(restoreContainer.VolumeMounts, corev1.VolumeMount{
+			Name:      "backup",
+			MountPath: backupPath,
+			ReadOnly:  true,
+		})
+	}
+	podSpec.Containers = []corev1.Container{restoreContainer}
+	podSpec.Volumes = volumes
+
+	labels := map[string]string{
+		"app":                       "sentry-restore",
+		"sentry.redhat.com/restore": restore.Name,
+	}
+	// a failed restore is rolled back, retrying it blindly won't help
+	backoffLimit := int32(0)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName(restore),
+			Namespace: restore.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(restore, job, r.scheme)
+	return job
+}